@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/natac13/monkey-compiler/internal/compiler"
+	"github.com/natac13/monkey-compiler/internal/object"
+)
+
+// buildFile compiles a Monkey source file and writes the bytecode to output in the .mkc format.
+// An empty output writes next to the source file with the extension replaced by .mkc,
+// and "-" writes to stdout.
+func buildFile(path, output string, stdio *object.IO) int {
+	name, source, err := readSource(path, stdio.Stdin)
+	if err != nil {
+		fmt.Fprintf(stdio.Stderr, "monkey: %s\n", err)
+		return 1
+	}
+
+	bytecode, ok := compileSource(name, source, stdio.Stderr)
+	if !ok {
+		return 1
+	}
+
+	if output == "" {
+		if path == "-" {
+			fmt.Fprintln(stdio.Stderr, "monkey: -o is required when building from stdin")
+			return 2
+		}
+		output = strings.TrimSuffix(path, filepath.Ext(path)) + ".mkc"
+	}
+
+	var buf bytes.Buffer
+	err = bytecode.Encode(&buf)
+	if err == nil {
+		if output == "-" {
+			_, err = stdio.Stdout.Write(buf.Bytes())
+		} else {
+			err = os.WriteFile(output, buf.Bytes(), 0o644)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stdio.Stderr, "monkey: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// execFile runs a precompiled .mkc bytecode file on the VM.
+func execFile(path string, args []string, stdio *object.IO) int {
+	name, data, err := readSource(path, stdio.Stdin)
+	if err != nil {
+		fmt.Fprintf(stdio.Stderr, "monkey: %s\n", err)
+		return 1
+	}
+
+	bytecode, err := compiler.Decode(strings.NewReader(data))
+	if err != nil {
+		fmt.Fprintf(stdio.Stderr, "monkey: %s: %s\n", name, err)
+		return 1
+	}
+
+	return execute(bytecode, args, stdio)
+}
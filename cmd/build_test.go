@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const buildSource = `let greet = fn(name) { "hello " + name }; puts(greet(args[0]));`
+
+func TestBuildExecRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "greet.mk")
+	if err := os.WriteFile(path, []byte(buildSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the output defaults to the source path with a .mkc extension
+	code, stdout, stderr := runCLI(t, "", "build", path)
+	if code != 0 || stdout != "" || stderr != "" {
+		t.Fatalf("build failed. code=%d, stdout=%q, stderr=%q", code, stdout, stderr)
+	}
+	code, stdout, stderr = runCLI(t, "", "exec", filepath.Join(dir, "greet.mkc"), "monkey")
+	if code != 0 || stdout != "hello monkey\n" || stderr != "" {
+		t.Errorf("wrong exec result. code=%d, stdout=%q, stderr=%q", code, stdout, stderr)
+	}
+
+	output := filepath.Join(dir, "out.mkc")
+	code, _, stderr = runCLI(t, "", "build", path, "-o", output)
+	if code != 0 {
+		t.Fatalf("build failed. code=%d, stderr=%q", code, stderr)
+	}
+	code, stdout, _ = runCLI(t, "", "exec", output, "file")
+	if code != 0 || stdout != "hello file\n" {
+		t.Errorf("wrong exec result. code=%d, stdout=%q", code, stdout)
+	}
+}
+
+func TestBuildToStdout(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "greet.mk")
+	if err := os.WriteFile(path, []byte(buildSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// -o - writes the bytecode to stdout rather than to a file named -
+	code, bytecode, stderr := runCLI(t, "", "build", path, "-o", "-")
+	if code != 0 || stderr != "" {
+		t.Fatalf("build failed. code=%d, stderr=%q", code, stderr)
+	}
+	if _, err := os.Stat("-"); err == nil {
+		t.Errorf("expected no file named -")
+	}
+
+	code, stdout, stderr := runCLI(t, bytecode, "exec", "-", "stdin")
+	if code != 0 || stdout != "hello stdin\n" || stderr != "" {
+		t.Errorf("wrong exec result. code=%d, stdout=%q, stderr=%q", code, stdout, stderr)
+	}
+
+	// source from stdin can be built to stdout too
+	code, bytecode, _ = runCLI(t, buildSource, "build", "-", "-o", "-")
+	if code != 0 {
+		t.Fatalf("build from stdin failed. code=%d", code)
+	}
+	code, stdout, _ = runCLI(t, bytecode, "exec", "-", "pipe")
+	if code != 0 || stdout != "hello pipe\n" {
+		t.Errorf("wrong exec result. code=%d, stdout=%q", code, stdout)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/natac13/monkey-compiler/internal/compiler"
+	"github.com/natac13/monkey-compiler/internal/object"
+)
+
+// disasmFile compiles a Monkey source file and prints its disassembly to stdout.
+func disasmFile(path string, stdio *object.IO) int {
+	name, source, err := readSource(path, stdio.Stdin)
+	if err != nil {
+		fmt.Fprintf(stdio.Stderr, "monkey: %s\n", err)
+		return 1
+	}
+
+	bytecode, ok := compileSource(name, source, stdio.Stderr)
+	if !ok {
+		return 1
+	}
+
+	fmt.Fprint(stdio.Stdout, compiler.Disassemble(bytecode))
+	return 0
+}
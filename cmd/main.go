@@ -5,10 +5,23 @@ import (
 	"os"
 	"os/user"
 
+	"github.com/natac13/monkey-compiler/internal/object"
 	"github.com/natac13/monkey-compiler/internal/repl"
 )
 
+const usage = `usage:
+  monkey                            start the REPL
+  monkey run <file.mk|-> [args...]  run a Monkey source file, "-" reads it from stdin
+  monkey build <file.mk> [-o out]   compile a source file to a .mkc bytecode file, "-o -" writes it to stdout
+  monkey exec <file.mkc> [args...]  run a compiled .mkc bytecode file
+  monkey disasm <file.mk|->         print the compiled bytecode of a source file
+`
+
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:], object.StandardIO()))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -18,3 +31,43 @@ func main() {
 	fmt.Printf("Feel free to type in commands\n")
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+// runCommand dispatches a CLI subcommand and returns the process exit code.
+// stdio holds the streams of the process, which scripts use as well.
+func runCommand(command string, args []string, stdio *object.IO) int {
+	switch command {
+	case "run":
+		if len(args) < 1 {
+			fmt.Fprint(stdio.Stderr, usage)
+			return 2
+		}
+		return runFile(args[0], args[1:], stdio)
+	case "build":
+		switch {
+		case len(args) == 1:
+			return buildFile(args[0], "", stdio)
+		case len(args) == 3 && args[1] == "-o":
+			return buildFile(args[0], args[2], stdio)
+		}
+		fmt.Fprint(stdio.Stderr, usage)
+		return 2
+	case "exec":
+		if len(args) < 1 {
+			fmt.Fprint(stdio.Stderr, usage)
+			return 2
+		}
+		return execFile(args[0], args[1:], stdio)
+	case "disasm":
+		if len(args) != 1 {
+			fmt.Fprint(stdio.Stderr, usage)
+			return 2
+		}
+		return disasmFile(args[0], stdio)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdio.Stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stdio.Stderr, "unknown command %q\n%s", command, usage)
+		return 2
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/natac13/monkey-compiler/internal/compiler"
+	"github.com/natac13/monkey-compiler/internal/lexer"
+	"github.com/natac13/monkey-compiler/internal/object"
+	"github.com/natac13/monkey-compiler/internal/parser"
+	"github.com/natac13/monkey-compiler/internal/vm"
+)
+
+// argsGlobalIndex is the global slot holding the script arguments as the `args` array.
+// It is defined before anything else, so it is always the first global.
+const argsGlobalIndex = 0
+
+// runFile lexes, parses, compiles and runs a Monkey source file on the VM.
+// It returns 1 if any of those steps fail.
+func runFile(path string, args []string, stdio *object.IO) int {
+	name, source, err := readSource(path, stdio.Stdin)
+	if err != nil {
+		fmt.Fprintf(stdio.Stderr, "monkey: %s\n", err)
+		return 1
+	}
+
+	bytecode, ok := compileSource(name, source, stdio.Stderr)
+	if !ok {
+		return 1
+	}
+
+	return execute(bytecode, args, stdio)
+}
+
+// readSource reads the program at path, or from stdin if path is "-".
+// It returns the name to use for the program in error messages.
+func readSource(path string, stdin io.Reader) (string, string, error) {
+	if path == "-" {
+		source, err := io.ReadAll(stdin)
+		return "<stdin>", string(source), err
+	}
+
+	source, err := os.ReadFile(path)
+	return path, string(source), err
+}
+
+// compileSource parses and compiles a program, reporting any errors to stderr.
+func compileSource(name, source string, stderr io.Writer) (*compiler.ByteCode, bool) {
+	l := lexer.New(stripShebang(source))
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(stderr, "%s:%s\n", name, msg)
+		}
+		return nil, false
+	}
+
+	comp := compiler.NewWithState(newSymbolTable(), []object.Object{})
+	err := comp.Compile(program)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s:%s\n", name, err)
+		return nil, false
+	}
+
+	return comp.ByteCode(), true
+}
+
+// execute runs the bytecode with the given script arguments, reporting runtime errors to stderr.
+func execute(bytecode *compiler.ByteCode, args []string, stdio *object.IO) int {
+	globals := make([]object.Object, vm.GlobalsSize)
+	globals[argsGlobalIndex] = argsArray(args)
+
+	machine := vm.NewWithGlobalStore(bytecode, globals)
+	machine.SetIO(stdio)
+	err := machine.Run()
+	if err != nil {
+		var runtimeErr *vm.RuntimeError
+		if errors.As(err, &runtimeErr) {
+			fmt.Fprintln(stdio.Stderr, runtimeErr.Traceback())
+		} else {
+			fmt.Fprintf(stdio.Stderr, "RuntimeError: %s\n", err)
+		}
+		return 1
+	}
+
+	return 0
+}
+
+// newSymbolTable returns a global symbol table with the builtins and the `args` global defined.
+func newSymbolTable() *compiler.SymbolTable {
+	symbolTable := compiler.NewSymbolTable()
+	symbolTable.Define("args")
+	symbolTable.DefineBuiltins(object.NewRegistry())
+	return symbolTable
+}
+
+func argsArray(args []string) *object.Array {
+	elements := make([]object.Object, len(args))
+	for i, arg := range args {
+		elements[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// stripShebang blanks out a leading `#!` line so scripts can be executed directly.
+// The newline is kept so positions in error messages still match the file.
+func stripShebang(source string) string {
+	if !strings.HasPrefix(source, "#!") {
+		return source
+	}
+
+	if i := strings.IndexByte(source, '\n'); i >= 0 {
+		return source[i:]
+	}
+	return ""
+}
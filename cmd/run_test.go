@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/natac13/monkey-compiler/internal/object"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name           string
+		source         string
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{
+			name:           "output",
+			source:         `puts(1 + 2);`,
+			expectedStdout: "3\n",
+		},
+		{
+			name:           "shebang",
+			source:         "#!/usr/bin/env monkey run\nputs(\"hello\");",
+			expectedStdout: "hello\n",
+		},
+		{
+			name:           "shebang keeps positions",
+			source:         "#!/usr/bin/env monkey run\nputs(missing);",
+			expectedCode:   1,
+			expectedStderr: "script.mk:2:6: undefined variable missing\n",
+		},
+		{
+			name:           "script args",
+			source:         `puts(len(args)); puts(args[0]); puts(args[1]);`,
+			args:           []string{"first", "second"},
+			expectedStdout: "2\nfirst\nsecond\n",
+		},
+		{
+			name:           "no script args",
+			source:         `puts(args);`,
+			expectedStdout: "[]\n",
+		},
+		{
+			name:         "syntax error",
+			source:       `let = 1;`,
+			expectedCode: 1,
+			expectedStderr: "script.mk:1:5: expected next token to be IDENT, got = instead\n" +
+				"script.mk:1:5: no prefix parse function for = found\n",
+		},
+		{
+			name:         "runtime error",
+			source:       "let f = fn() { 1 / 0 };\nf();",
+			expectedCode: 1,
+			expectedStderr: "Traceback (most recent call last):\n" +
+				"  in <main> at 2:2 (offset 0011)\n" +
+				"  in f at 1:18 (offset 0006)\n" +
+				"RuntimeError: division by zero\n",
+		},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "script.mk")
+		if err := os.WriteFile(path, []byte(tt.source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		// errors are reported with the path the script was given as
+		code, stdout, stderr := runCLI(t, "", append([]string{"run", path}, tt.args...)...)
+		stderr = strings.ReplaceAll(stderr, path, "script.mk")
+
+		if code != tt.expectedCode {
+			t.Errorf("%s: wrong exit code. want=%d, got=%d", tt.name, tt.expectedCode, code)
+		}
+		if stdout != tt.expectedStdout {
+			t.Errorf("%s: wrong stdout. want=%q, got=%q", tt.name, tt.expectedStdout, stdout)
+		}
+		if stderr != tt.expectedStderr {
+			t.Errorf("%s: wrong stderr. want=%q, got=%q", tt.name, tt.expectedStderr, stderr)
+		}
+	}
+}
+
+func TestRunStdin(t *testing.T) {
+	code, stdout, stderr := runCLI(t, `puts(args[0]);`, "run", "-", "arg")
+	if code != 0 || stdout != "arg\n" || stderr != "" {
+		t.Errorf("wrong result. code=%d, stdout=%q, stderr=%q", code, stdout, stderr)
+	}
+
+	// errors name the program <stdin>
+	code, _, stderr = runCLI(t, `missing`, "run", "-")
+	if code != 1 || stderr != "<stdin>:1:1: undefined variable missing\n" {
+		t.Errorf("wrong result. code=%d, stderr=%q", code, stderr)
+	}
+}
+
+func TestRunUsageErrors(t *testing.T) {
+	tests := []struct {
+		args         []string
+		expectedCode int
+	}{
+		{[]string{"run"}, 2},
+		{[]string{"unknown"}, 2},
+		{[]string{"run", filepath.Join(t.TempDir(), "missing.mk")}, 1},
+	}
+
+	for _, tt := range tests {
+		code, stdout, stderr := runCLI(t, "", tt.args...)
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d", tt.args, tt.expectedCode, code)
+		}
+		if stdout != "" {
+			t.Errorf("%v: expected no output, got=%q", tt.args, stdout)
+		}
+		if stderr == "" {
+			t.Errorf("%v: expected an error message", tt.args)
+		}
+	}
+
+	code, stdout, _ := runCLI(t, "", "help")
+	if code != 0 || stdout != usage {
+		t.Errorf("wrong help. code=%d, stdout=%q", code, stdout)
+	}
+}
+
+// runCLI runs the command line args with stdin as the input and returns the exit code
+// and what was written to stdout and stderr.
+func runCLI(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	stdio := &object.IO{Stdin: strings.NewReader(stdin), Stdout: &stdout, Stderr: &stderr}
+	code := runCommand(args[0], args[1:], stdio)
+	return code, stdout.String(), stderr.String()
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"sort"
 )
 
 const (
@@ -13,12 +14,14 @@ const (
 	OpSub
 	OpMul
 	OpDiv
+	OpMod
 	OpTrue
 	OpFalse
 	OpNull
 	OpEqual
 	OpNotEqual
 	OpGreaterThan
+	OpGreaterThanEqual
 	OpMinus
 	OpBang
 	// tell the vm to jump if the top of the stack is not truthy.
@@ -46,6 +49,50 @@ const (
 	// the second is the number of free variables the closure has (1 byte).
 	OpClosure
 	OpCurrentClosure
+	// OpStackDepth pushes the number of values on the stack of the current frame, and
+	// OpUnwindStack pops such a number and drops the values above it. A loop records its depth
+	// so break and continue can drop the operands of the expressions they leave
+	OpStackDepth
+	OpUnwindStack
+	// replaces the value at the top of the stack with an iterator over it, for a for-in loop
+	OpGetIter
+	// pops an iterator and advances it. operand width is 1 byte, the number of loop variables.
+	// pushes their values and true, or only false once the iterator is exhausted
+	OpIterNext
+	// pushes copies of the top values of the stack. operand width is 1 byte, the number of values
+	OpDup
+	// pops a value, an index and a collection, sets the collection's element at the index
+	// to the value and pushes the value
+	OpSetIndex
+	// the cell opcodes access variables shared by reference between a function and its closures.
+	// their operand width is 1 byte, the index of the local or free variable holding the cell.
+	// OpMakeCell pops a value and puts a new cell holding it in the local
+	OpMakeCell
+	OpGetLocalCell
+	OpSetLocalCell
+	OpGetFreeCell
+	OpSetFreeCell
+	// the match opcodes test the value at the top of the stack for a pattern, leave it in place
+	// and push the result. OpMatchArray has 2 operands, the number of elements the array must
+	// have (2 bytes) and whether it may have more, for a pattern with a rest (1 byte).
+	OpMatchArray
+	OpMatchHash
+	// pops a key and a hash and pushes whether the hash has the key
+	OpHasKey
+	// pops an array and pushes a new array of its elements from the index given by the
+	// operand on. operand width is 2 bytes
+	OpSlice
+	// the destructure opcodes check the value at the top of the stack can be destructured by a
+	// let, as an array or a hash. Their operand width is 1 byte, 1 for a strict let, which
+	// doesn't replace null with an empty array or hash
+	OpDestructureArray
+	OpDestructureHash
+	// like OpIndex, but an index out of range or a missing key is an error
+	OpIndexStrict
+	// jumps if the call of the current function passed an argument for a parameter, skipping
+	// the code filling in its default. has 2 operands, the position to jump to (2 bytes) and
+	// the index of the parameter (1 byte)
+	OpJumpIfPassed
 )
 
 type Instructions []byte
@@ -63,36 +110,57 @@ type Definition struct {
 // meaning that if the width is 2, we read 2 bytes from the instruction to get the operand
 // example of a definition is OpConstant, which has a width of 2, meaning that the operand is 2 bytes or 16 bits
 var definitions = map[Opcode]*Definition{
-	OpConstant:       {"OpConstant", []int{2}},
-	OpAdd:            {"OpAdd", []int{}},
-	OpPop:            {"OpPop", []int{}},
-	OpSub:            {"OpSub", []int{}},
-	OpMul:            {"OpMul", []int{}},
-	OpDiv:            {"OpDiv", []int{}},
-	OpTrue:           {"OpTrue", []int{}},
-	OpFalse:          {"OpFalse", []int{}},
-	OpNull:           {"OpNull", []int{}},
-	OpEqual:          {"OpEqual", []int{}},
-	OpNotEqual:       {"OpNotEqual", []int{}},
-	OpGreaterThan:    {"OpGreaterThan", []int{}},
-	OpMinus:          {"OpMinus", []int{}},
-	OpBang:           {"OpBang", []int{}},
-	OpJumpNotTruthy:  {"OpJumpNotTruthy", []int{2}},
-	OpJump:           {"OpJump", []int{2}},
-	OpSetGlobal:      {"OpSetGlobal", []int{2}},
-	OpGetGlobal:      {"OpGetGlobal", []int{2}},
-	OpSetLocal:       {"OpSetLocal", []int{1}},
-	OpGetLocal:       {"OpGetLocal", []int{1}},
-	OpGetFree:        {"OpGetFree", []int{1}},
-	OpArray:          {"OpArray", []int{2}},
-	OpHash:           {"OpHash", []int{2}},
-	OpIndex:          {"OpIndex", []int{}},
-	OpCall:           {"OpCall", []int{1}},
-	OpReturnValue:    {"OpReturnValue", []int{}},
-	OpReturn:         {"OpReturn", []int{}},
-	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
-	OpClosure:        {"OpClosure", []int{2, 1}},
-	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpConstant:         {"OpConstant", []int{2}},
+	OpAdd:              {"OpAdd", []int{}},
+	OpPop:              {"OpPop", []int{}},
+	OpSub:              {"OpSub", []int{}},
+	OpMul:              {"OpMul", []int{}},
+	OpDiv:              {"OpDiv", []int{}},
+	OpMod:              {"OpMod", []int{}},
+	OpTrue:             {"OpTrue", []int{}},
+	OpFalse:            {"OpFalse", []int{}},
+	OpNull:             {"OpNull", []int{}},
+	OpEqual:            {"OpEqual", []int{}},
+	OpNotEqual:         {"OpNotEqual", []int{}},
+	OpGreaterThan:      {"OpGreaterThan", []int{}},
+	OpGreaterThanEqual: {"OpGreaterThanEqual", []int{}},
+	OpMinus:            {"OpMinus", []int{}},
+	OpBang:             {"OpBang", []int{}},
+	OpJumpNotTruthy:    {"OpJumpNotTruthy", []int{2}},
+	OpJump:             {"OpJump", []int{2}},
+	OpSetGlobal:        {"OpSetGlobal", []int{2}},
+	OpGetGlobal:        {"OpGetGlobal", []int{2}},
+	OpSetLocal:         {"OpSetLocal", []int{1}},
+	OpGetLocal:         {"OpGetLocal", []int{1}},
+	OpGetFree:          {"OpGetFree", []int{1}},
+	OpArray:            {"OpArray", []int{2}},
+	OpHash:             {"OpHash", []int{2}},
+	OpIndex:            {"OpIndex", []int{}},
+	OpCall:             {"OpCall", []int{1}},
+	OpReturnValue:      {"OpReturnValue", []int{}},
+	OpReturn:           {"OpReturn", []int{}},
+	OpGetBuiltin:       {"OpGetBuiltin", []int{1}},
+	OpClosure:          {"OpClosure", []int{2, 1}},
+	OpCurrentClosure:   {"OpCurrentClosure", []int{}},
+	OpStackDepth:       {"OpStackDepth", []int{}},
+	OpUnwindStack:      {"OpUnwindStack", []int{}},
+	OpGetIter:          {"OpGetIter", []int{}},
+	OpIterNext:         {"OpIterNext", []int{1}},
+	OpDup:              {"OpDup", []int{1}},
+	OpSetIndex:         {"OpSetIndex", []int{}},
+	OpMakeCell:         {"OpMakeCell", []int{1}},
+	OpGetLocalCell:     {"OpGetLocalCell", []int{1}},
+	OpSetLocalCell:     {"OpSetLocalCell", []int{1}},
+	OpGetFreeCell:      {"OpGetFreeCell", []int{1}},
+	OpSetFreeCell:      {"OpSetFreeCell", []int{1}},
+	OpMatchArray:       {"OpMatchArray", []int{2, 1}},
+	OpMatchHash:        {"OpMatchHash", []int{}},
+	OpHasKey:           {"OpHasKey", []int{}},
+	OpSlice:            {"OpSlice", []int{2}},
+	OpDestructureArray: {"OpDestructureArray", []int{1}},
+	OpDestructureHash:  {"OpDestructureHash", []int{1}},
+	OpIndexStrict:      {"OpIndexStrict", []int{}},
+	OpJumpIfPassed:     {"OpJumpIfPassed", []int{2, 1}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -140,19 +208,40 @@ func Make(op Opcode, operands ...int) []byte {
 }
 
 func (ins Instructions) String() string {
+	return ins.Format(nil)
+}
+
+// Annotator returns a comment to print after an instruction, or "" for none.
+type Annotator func(op Opcode, operands []int) string
+
+// Format prints one instruction per line, prefixed with its offset.
+// If annotate is not nil, its non-empty results are appended as "; comment".
+func (ins Instructions) Format(annotate Annotator) string {
 	var out bytes.Buffer
 
 	i := 0
 	for i < len(ins) {
 		def, err := Lookup(ins[i])
 		if err != nil {
-			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+			i++
 			continue
 		}
 
+		if i+1+def.width() > len(ins) {
+			fmt.Fprintf(&out, "%04d ERROR: truncated %s\n", i, def.Name)
+			break
+		}
+
 		operands, read := ReadOperands(def, ins[i+1:])
 
-		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		line := ins.fmtInstruction(def, operands)
+		if annotate != nil {
+			if comment := annotate(Opcode(ins[i]), operands); comment != "" {
+				line += " ; " + comment
+			}
+		}
+		fmt.Fprintf(&out, "%04d %s\n", i, line)
 
 		i += 1 + read
 	}
@@ -160,6 +249,15 @@ func (ins Instructions) String() string {
 	return out.String()
 }
 
+// width returns the number of operand bytes following the opcode.
+func (def *Definition) width() int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return width
+}
+
 func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 	operandCount := len(def.OperandWidths)
 
@@ -197,6 +295,25 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	return operands, offset
 }
 
+// SourceMap maps instruction offsets to the source position that produced them.
+// Entries are sorted by Offset and each entry covers all instructions up to the next one.
+type SourceMap []SourceMapEntry
+
+type SourceMapEntry struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Lookup returns the entry covering the instruction at the given offset.
+func (sm SourceMap) Lookup(offset int) (SourceMapEntry, bool) {
+	i := sort.Search(len(sm), func(i int) bool { return sm[i].Offset > offset })
+	if i == 0 {
+		return SourceMapEntry{}, false
+	}
+	return sm[i-1], true
+}
+
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
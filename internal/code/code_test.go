@@ -1,6 +1,9 @@
 package code
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 func TestMake(t *testing.T) {
 	tests := []struct {
@@ -54,6 +57,42 @@ func TestInstructionsString(t *testing.T) {
 	}
 }
 
+func TestSourceMapLookup(t *testing.T) {
+	sourceMap := SourceMap{
+		{Offset: 0, Line: 1, Column: 1},
+		{Offset: 3, Line: 1, Column: 5},
+		{Offset: 10, Line: 2, Column: 1},
+	}
+
+	tests := []struct {
+		offset       int
+		expectedLine int
+		expectedCol  int
+	}{
+		{0, 1, 1},
+		{2, 1, 1},
+		{3, 1, 5},
+		{9, 1, 5},
+		{10, 2, 1},
+		{50, 2, 1},
+	}
+
+	for _, tt := range tests {
+		entry, ok := sourceMap.Lookup(tt.offset)
+		if !ok {
+			t.Fatalf("no entry found for offset %d", tt.offset)
+		}
+		if entry.Line != tt.expectedLine || entry.Column != tt.expectedCol {
+			t.Errorf("wrong entry for offset %d. want=%d:%d, got=%d:%d",
+				tt.offset, tt.expectedLine, tt.expectedCol, entry.Line, entry.Column)
+		}
+	}
+
+	if _, ok := (SourceMap{}).Lookup(0); ok {
+		t.Errorf("expected no entry in an empty source map")
+	}
+}
+
 func TestReadOperands(t *testing.T) {
 	tests := []struct {
 		op        Opcode
@@ -85,3 +124,27 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestInstructionsFormat(t *testing.T) {
+	instructions := Instructions{}
+	instructions = append(instructions, Make(OpConstant, 2)...)
+	instructions = append(instructions, Make(OpPop)...)
+	instructions = append(instructions, 255)
+	instructions = append(instructions, Make(OpJump, 1)[:2]...)
+
+	annotate := func(op Opcode, operands []int) string {
+		if op == OpConstant {
+			return fmt.Sprintf("constant #%d", operands[0])
+		}
+		return ""
+	}
+
+	expected := `0000 OpConstant 2 ; constant #2
+0003 OpPop
+0004 ERROR: opcode 255 undefined
+0005 ERROR: truncated OpJump
+`
+	if actual := instructions.Format(annotate); actual != expected {
+		t.Errorf("instructions wrongly formatted. want=%q, got=%q", expected, actual)
+	}
+}
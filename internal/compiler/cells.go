@@ -0,0 +1,211 @@
+package compiler
+
+import "github.com/natac13/monkey-compiler/internal/ast"
+
+// cellVariables returns the variables of a function that must live in cells: the ones both
+// captured by a nested function and changed after they are first bound, by an assignment,
+// another let or a loop. Closures capture the cell of such a variable instead of copying its
+// value, so the function and its closures see each other's changes. The other captured
+// variables are still copied, which is cheaper to access.
+//
+// The analysis goes by name and errs on the side of using a cell, for example when a nested
+// function declares a variable of the same name.
+func cellVariables(fn *ast.FunctionLiteral) []string {
+	a := &cellAnalysis{
+		declared: map[string]bool{},
+		changed:  map[string]bool{},
+		captured: map[string]bool{},
+	}
+	for _, p := range fn.Parameters {
+		a.declare(p.Value)
+	}
+	if fn.Rest != nil {
+		a.declare(fn.Rest.Value)
+	}
+	for _, value := range fn.Defaults {
+		a.walk(value)
+	}
+	// a parameter left out is set when its default runs, after the defaults before it, so a
+	// closure created by one of the defaults must share it through a cell
+	for _, p := range fn.Parameters[len(fn.Parameters)-len(fn.Defaults):] {
+		if a.captured[p.Value] {
+			a.changed[p.Value] = true
+		}
+	}
+	a.walk(fn.Body)
+
+	cells := []string{}
+	for _, name := range a.order {
+		if a.captured[name] && a.changed[name] {
+			cells = append(cells, name)
+		}
+	}
+	return cells
+}
+
+// assignsOwnName reports whether the defaults or body of fn change the variable fn is bound
+// to, for example with f = 1 inside f. The name then isn't defined as the function itself in
+// the body, so it resolves to that variable and can be assigned: a global, or a variable of
+// the enclosing function, which cellVariables puts in a cell as the body captures and changes it.
+func assignsOwnName(fn *ast.FunctionLiteral) bool {
+	a := &cellAnalysis{
+		declared: map[string]bool{},
+		changed:  map[string]bool{},
+		captured: map[string]bool{},
+	}
+	for _, value := range fn.Defaults {
+		a.walk(value)
+	}
+	a.walk(fn.Body)
+	return a.changed[fn.Name]
+}
+
+type cellAnalysis struct {
+	// order lists the variables the function declares, in order of declaration
+	order    []string
+	declared map[string]bool
+	changed  map[string]bool
+	captured map[string]bool
+	// functionDepth is the number of nested functions around the node being walked
+	functionDepth int
+	// loopDepth is the number of loops around the node being walked
+	loopDepth int
+}
+
+func (a *cellAnalysis) declare(name string) {
+	// nested functions declare their own variables
+	if a.functionDepth > 0 {
+		return
+	}
+	// a variable bound again, or bound in a loop, changes after it could have been captured
+	if a.declared[name] || a.loopDepth > 0 {
+		a.changed[name] = true
+	}
+	if !a.declared[name] {
+		a.declared[name] = true
+		a.order = append(a.order, name)
+	}
+}
+
+func (a *cellAnalysis) reference(name string) {
+	if a.functionDepth > 0 {
+		a.captured[name] = true
+	}
+}
+
+func (a *cellAnalysis) walk(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			a.walk(s)
+		}
+
+	case *ast.ExpressionStatement:
+		a.walk(node.Expression)
+
+	case *ast.LetStatement:
+		a.declare(node.Name.Value)
+		a.walk(node.Value)
+
+	case *ast.DestructuringLetStatement:
+		a.walk(node.Value)
+		a.walk(node.Pattern)
+
+	case *ast.ReturnStatement:
+		a.walk(node.ReturnValue)
+
+	case *ast.WhileStatement:
+		a.walk(node.Condition)
+		a.loopDepth++
+		a.walk(node.Body)
+		a.loopDepth--
+
+	case *ast.ForStatement:
+		a.walk(node.Iterable)
+		a.loopDepth++
+		for _, v := range node.Variables {
+			a.declare(v.Value)
+		}
+		a.walk(node.Body)
+		a.loopDepth--
+
+	case *ast.Identifier:
+		a.reference(node.Value)
+
+	case *ast.AssignExpression:
+		if ident, ok := node.Target.(*ast.Identifier); ok {
+			a.changed[ident.Value] = true
+		}
+		a.walk(node.Target)
+		a.walk(node.Value)
+
+	case *ast.MatchExpression:
+		a.walk(node.Subject)
+		for _, arm := range node.Arms {
+			a.walk(arm.Pattern)
+			if arm.Guard != nil {
+				a.walk(arm.Guard)
+			}
+			a.walk(arm.Body)
+		}
+
+	case *ast.IdentifierPattern:
+		a.declare(node.Name.Value)
+
+	case *ast.ArrayPattern:
+		for _, el := range node.Elements {
+			a.walk(el)
+		}
+		if node.Rest != nil {
+			a.declare(node.Rest.Value)
+		}
+
+	case *ast.HashPattern:
+		for _, pair := range node.Pairs {
+			a.walk(pair.Pattern)
+		}
+
+	case *ast.PrefixExpression:
+		a.walk(node.Right)
+
+	case *ast.InfixExpression:
+		a.walk(node.Left)
+		a.walk(node.Right)
+
+	case *ast.IfExpression:
+		a.walk(node.Condition)
+		a.walk(node.Consequence)
+		if node.Alternative != nil {
+			a.walk(node.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		a.functionDepth++
+		for _, value := range node.Defaults {
+			a.walk(value)
+		}
+		a.walk(node.Body)
+		a.functionDepth--
+
+	case *ast.CallExpression:
+		a.walk(node.Function)
+		for _, arg := range node.Arguments {
+			a.walk(arg)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			a.walk(el)
+		}
+
+	case *ast.HashLiteral:
+		for key, value := range node.Pairs {
+			a.walk(key)
+			a.walk(value)
+		}
+
+	case *ast.IndexExpression:
+		a.walk(node.Left)
+		a.walk(node.Index)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/natac13/monkey-compiler/internal/ast"
 	"github.com/natac13/monkey-compiler/internal/code"
 	"github.com/natac13/monkey-compiler/internal/object"
+	"github.com/natac13/monkey-compiler/internal/token"
 )
 
 type EmittedInstruction struct {
@@ -20,6 +21,21 @@ type CompilationScope struct {
 	lastInstruction EmittedInstruction
 	// the instruction before the last one
 	previousInstruction EmittedInstruction
+	// source positions of the emitted instructions
+	sourceMap code.SourceMap
+	// the loops enclosing the code being compiled, innermost last
+	loops []*loop
+}
+
+// loop holds the jump targets of a loop being compiled, for its break and continue statements.
+type loop struct {
+	// continuePos is the position continue jumps to
+	continuePos int
+	// depth is the hidden variable holding the stack depth at the start of the loop
+	depth Symbol
+	// breakJumps are the positions of the OpJump instructions emitted for break,
+	// changed to jump past the loop once its end is known
+	breakJumps []int
 }
 
 type Compiler struct {
@@ -27,9 +43,17 @@ type Compiler struct {
 	symbolTable *SymbolTable
 	scopes      []CompilationScope
 	scopeIndex  int
+	// position of the node currently being compiled, recorded in the source map on emit
+	pos token.Position
 }
 
 func New() *Compiler {
+	return NewWithBuiltins(object.NewRegistry())
+}
+
+// NewWithBuiltins returns a compiler resolving builtin names against the given registry.
+// The bytecode must then be run by a VM using the same registry.
+func NewWithBuiltins(builtins *object.Registry) *Compiler {
 	mainScope := CompilationScope{
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
@@ -37,10 +61,7 @@ func New() *Compiler {
 	}
 
 	symbolTable := NewSymbolTable()
-
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
-	}
+	symbolTable.DefineBuiltins(builtins)
 
 	return &Compiler{
 		constants:   []object.Object{},
@@ -58,6 +79,12 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
+	if pos := node.Pos(); pos.IsValid() {
+		outerPos := c.pos
+		c.pos = pos
+		defer func() { c.pos = outerPos }()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -79,7 +106,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		case "-":
 			c.emit(code.OpMinus)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return fmt.Errorf("%s: unknown operator %s", node.Pos(), node.Operator)
 		}
 
 	case *ast.ExpressionStatement:
@@ -90,10 +117,15 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpPop)
 
 	case *ast.InfixExpression:
-		// Special case for < operator, where we need to reverse the operands order on the stack
+		// && and || only evaluate their right side when needed, so they compile to jumps
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+
+		// Special case for < and <= operators, where we need to reverse the operands order on the stack
 		// therefore we compile the right side first, than the left side.
-		// And emit the OpGreaterThan opcode instead of OpLessThan
-		if node.Operator == "<" {
+		// And emit the OpGreaterThan(Equal) opcode instead of OpLessThan(Equal)
+		if node.Operator == "<" || node.Operator == "<=" {
 			err := c.Compile(node.Right)
 			if err != nil {
 				return err
@@ -103,7 +135,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 			if err != nil {
 				return err
 			}
-			c.emit(code.OpGreaterThan)
+			if node.Operator == "<" {
+				c.emit(code.OpGreaterThan)
+			} else {
+				c.emit(code.OpGreaterThanEqual)
+			}
 			return nil
 		}
 		// normal cases
@@ -126,20 +162,28 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
 		case ">":
 			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterThanEqual)
 		case "==":
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return fmt.Errorf("%s: unknown operator %s", node.Pos(), node.Operator)
 		}
 
 	case *ast.IntegerLiteral:
 		intObj := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(intObj))
 
+	case *ast.FloatLiteral:
+		floatObj := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(floatObj))
+
 	case *ast.StringLiteral:
 		strObj := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(strObj))
@@ -165,8 +209,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
+		// the if expression must leave a value, even when the block doesn't end with an expression
 		if c.lastInstructionIs(code.OpPop) {
 			c.removeLastPop()
+		} else {
+			c.emit(code.OpNull)
 		}
 
 		// emit an OpJump with a bogus value, which is fixed after we compile the alternative block
@@ -185,6 +232,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 			if c.lastInstructionIs(code.OpPop) {
 				c.removeLastPop()
+			} else {
+				c.emit(code.OpNull)
 			}
 		}
 
@@ -199,6 +248,81 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 
+	case *ast.WhileStatement:
+		depth := c.saveStackDepth()
+		startPos := len(c.currentInstructions())
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		// emit an OpJumpNotTruthy with a bogus value, which is fixed once the end of the loop is known
+		exitJumpPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		c.enterLoop(startPos, depth)
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, startPos)
+		c.leaveLoop(exitJumpPos)
+
+	case *ast.ForStatement:
+		err := c.Compile(node.Iterable)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpGetIter)
+		// the iterator is kept in a hidden variable, one per loop nesting depth. Its name
+		// can't clash with an identifier.
+		iterator := c.symbolTable.Define(fmt.Sprintf("@iterator%d", len(c.scopes[c.scopeIndex].loops)))
+		c.storeSymbol(iterator)
+		depth := c.saveStackDepth()
+
+		startPos := len(c.currentInstructions())
+		c.loadSymbol(iterator)
+		c.emit(code.OpIterNext, len(node.Variables))
+		// emit an OpJumpNotTruthy with a bogus value, which is fixed once the end of the loop is known
+		exitJumpPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		symbols := make([]Symbol, len(node.Variables))
+		for i, variable := range node.Variables {
+			symbols[i] = c.symbolTable.Define(variable.Value)
+		}
+		// OpIterNext pushes the values in order, so the last variable is on top
+		for i := len(symbols) - 1; i >= 0; i-- {
+			c.storeSymbol(symbols[i])
+		}
+
+		c.enterLoop(startPos, depth)
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, startPos)
+		c.leaveLoop(exitJumpPos)
+
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("%s: break outside of a loop", node.Pos())
+		}
+		// a break inside an expression leaves its pending operands on the stack, drop them
+		c.loadSymbol(loop.depth)
+		c.emit(code.OpUnwindStack)
+		// the bogus jump target is fixed when leaving the loop
+		jumpPos := c.emit(code.OpJump, 9999)
+		loop.breakJumps = append(loop.breakJumps, jumpPos)
+
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("%s: continue outside of a loop", node.Pos())
+		}
+		c.loadSymbol(loop.depth)
+		c.emit(code.OpUnwindStack)
+		c.emit(code.OpJump, loop.continuePos)
+
 	case *ast.LetStatement:
 		// defining a symbol any function variable so it can reference itself in the Body when compiling
 		symbol := c.symbolTable.Define(node.Name.Value)
@@ -206,17 +330,24 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
+		c.storeSymbol(symbol)
+
+	case *ast.DestructuringLetStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		err = c.compileDestructuring(node.Pattern, node.Strict)
+		if err != nil {
+			return err
 		}
+		c.emit(code.OpPop)
 
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
 			// compile time error for undefined variables
-			return fmt.Errorf("undefined variable %s", node.Value)
+			return fmt.Errorf("%s: undefined variable %s", node.Pos(), node.Value)
 		}
 		c.loadSymbol(symbol)
 
@@ -252,6 +383,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// multiply the length of the pairs by 2 because we add each key and value to the bytecode
 		c.emit(code.OpHash, len(node.Pairs)*2)
 
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+
 	case *ast.IndexExpression:
 		err := c.Compile(node.Left)
 		if err != nil {
@@ -265,13 +402,22 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 	case *ast.FunctionLiteral:
 		c.enterScope()
-		if node.Name != "" {
+		if node.Name != "" && !assignsOwnName(node) {
 			c.symbolTable.DefineFunctionName(node.Name)
 		}
 		for _, p := range node.Parameters {
 			c.symbolTable.Define(p.Value)
 		}
-		err := c.Compile(node.Body)
+		if node.Rest != nil {
+			c.symbolTable.Define(node.Rest.Value)
+		}
+		c.defineCells(node)
+
+		err := c.compileDefaults(node)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.Body)
 		if err != nil {
 			return err
 		}
@@ -283,16 +429,21 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
+		sourceMap := c.scopes[c.scopeIndex].sourceMap
 		instructions := c.leaveScope()
 
 		for _, s := range freeSymbols {
-			c.loadSymbol(s)
+			c.loadCapture(s)
 		}
 
 		compiledFn := &object.CompiledFunction{
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			NumDefaults:   len(node.Defaults),
+			Variadic:      node.Rest != nil,
+			Name:          node.Name,
+			SourceMap:     sourceMap,
 		}
 		fnIndex := c.addConstant(compiledFn)
 		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
@@ -321,6 +472,384 @@ func (c *Compiler) Compile(node ast.Node) error {
 	return nil
 }
 
+// compileLogicalExpression compiles && and || into conditional jumps.
+// The right operand is skipped when the left one already decides the result,
+// and the result is always true or false.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	falseJumps := []int{}
+	trueJumps := []int{}
+
+	if node.Operator == "&&" {
+		// a falsy left side makes the whole expression false
+		falseJumps = append(falseJumps, c.emit(code.OpJumpNotTruthy, 9999))
+	} else {
+		// a truthy left side makes the whole expression true
+		jumpToRightPos := c.emit(code.OpJumpNotTruthy, 9999)
+		trueJumps = append(trueJumps, c.emit(code.OpJump, 9999))
+		c.changeOperand(jumpToRightPos, len(c.currentInstructions()))
+	}
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+	falseJumps = append(falseJumps, c.emit(code.OpJumpNotTruthy, 9999))
+
+	truePos := len(c.currentInstructions())
+	c.emit(code.OpTrue)
+	jumpToEndPos := c.emit(code.OpJump, 9999)
+
+	falsePos := len(c.currentInstructions())
+	c.emit(code.OpFalse)
+
+	for _, pos := range trueJumps {
+		c.changeOperand(pos, truePos)
+	}
+	for _, pos := range falseJumps {
+		c.changeOperand(pos, falsePos)
+	}
+	c.changeOperand(jumpToEndPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileMatchExpression compiles a match expression into a sequence of tests, one per arm.
+// The subject stays on the stack while the pattern and guard of an arm are tested, and is
+// popped before the body of the matching arm runs. A failed test jumps to the next arm.
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	err := c.Compile(node.Subject)
+	if err != nil {
+		return err
+	}
+
+	endJumps := []int{}
+	for _, arm := range node.Arms {
+		failJumps, err := c.compilePattern(arm.Pattern)
+		if err != nil {
+			return err
+		}
+		if arm.Guard != nil {
+			err := c.Compile(arm.Guard)
+			if err != nil {
+				return err
+			}
+			failJumps = append(failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+		}
+
+		c.emit(code.OpPop)
+		err = c.Compile(arm.Body)
+		if err != nil {
+			return err
+		}
+		// the arm must leave a value, even when the body doesn't end with an expression
+		if c.lastInstructionIs(code.OpPop) {
+			c.removeLastPop()
+		} else {
+			c.emit(code.OpNull)
+		}
+		// emit an OpJump with a bogus value, which is fixed once the end of the match is known
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+		nextArmPos := len(c.currentInstructions())
+		for _, pos := range failJumps {
+			c.changeOperand(pos, nextArmPos)
+		}
+	}
+
+	// no arm matched
+	c.emit(code.OpPop)
+	c.emit(code.OpNull)
+
+	afterMatchPos := len(c.currentInstructions())
+	for _, pos := range endJumps {
+		c.changeOperand(pos, afterMatchPos)
+	}
+
+	return nil
+}
+
+// compilePattern emits the tests of a pattern against the value at the top of the stack,
+// which they leave in place, and binds the names in the pattern as they are reached.
+// It returns the positions of the jumps taken when the pattern doesn't match, to be
+// pointed at the next arm.
+func (c *Compiler) compilePattern(pattern ast.Pattern) ([]int, error) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return nil, nil
+
+	case *ast.IdentifierPattern:
+		symbol := c.symbolTable.Define(pattern.Name.Value)
+		c.emit(code.OpDup, 1)
+		c.storeSymbol(symbol)
+		return nil, nil
+
+	case *ast.LiteralPattern:
+		c.emit(code.OpDup, 1)
+		err := c.Compile(pattern.Value)
+		if err != nil {
+			return nil, err
+		}
+		c.emit(code.OpEqual)
+		return []int{c.emit(code.OpJumpNotTruthy, 9999)}, nil
+
+	case *ast.ArrayPattern:
+		hasRest := 0
+		if pattern.HasRest {
+			hasRest = 1
+		}
+		c.emit(code.OpMatchArray, len(pattern.Elements), hasRest)
+		failJumps := []int{c.emit(code.OpJumpNotTruthy, 9999)}
+
+		for i, el := range pattern.Elements {
+			index := &object.Integer{Value: int64(i)}
+			jumps, err := c.compileElementPattern(el, func() error {
+				c.emit(code.OpConstant, c.addConstant(index))
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			failJumps = append(failJumps, jumps...)
+		}
+
+		if pattern.Rest != nil {
+			symbol := c.symbolTable.Define(pattern.Rest.Value)
+			c.emit(code.OpDup, 1)
+			c.emit(code.OpSlice, len(pattern.Elements))
+			c.storeSymbol(symbol)
+		}
+		return failJumps, nil
+
+	case *ast.HashPattern:
+		c.emit(code.OpMatchHash)
+		failJumps := []int{c.emit(code.OpJumpNotTruthy, 9999)}
+
+		for _, pair := range pattern.Pairs {
+			c.emit(code.OpDup, 1)
+			err := c.Compile(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			c.emit(code.OpHasKey)
+			failJumps = append(failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+
+			key := pair.Key
+			jumps, err := c.compileElementPattern(pair.Pattern, func() error {
+				return c.Compile(key)
+			})
+			if err != nil {
+				return nil, err
+			}
+			failJumps = append(failJumps, jumps...)
+		}
+		return failJumps, nil
+
+	default:
+		return nil, fmt.Errorf("%s: unknown pattern %s", pattern.Pos(), pattern.String())
+	}
+}
+
+// compileElementPattern emits the tests of a pattern against an element of the array or hash
+// at the top of the stack. emitIndex emits the index or key of the element.
+func (c *Compiler) compileElementPattern(pattern ast.Pattern, emitIndex func() error) ([]int, error) {
+	if _, ok := pattern.(*ast.WildcardPattern); ok {
+		return nil, nil
+	}
+
+	c.emit(code.OpDup, 1)
+	err := emitIndex()
+	if err != nil {
+		return nil, err
+	}
+	c.emit(code.OpIndex)
+
+	failJumps, err := c.compilePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	c.emit(code.OpPop)
+	if len(failJumps) == 0 {
+		return nil, nil
+	}
+
+	// the element is still on the stack when one of its tests fails, so the failed tests
+	// jump to a pop of the element before leaving the pattern
+	skipJump := c.emit(code.OpJump, 9999)
+	popPos := len(c.currentInstructions())
+	for _, pos := range failJumps {
+		c.changeOperand(pos, popPos)
+	}
+	c.emit(code.OpPop)
+	failJump := c.emit(code.OpJump, 9999)
+	c.changeOperand(skipJump, len(c.currentInstructions()))
+
+	return []int{failJump}, nil
+}
+
+// compileDestructuring emits the bindings of the names in a let pattern to the parts of the
+// value at the top of the stack, which is left in place. The names are defined after the
+// value is compiled, so `let [a, b] = [b, a];` swaps a and b.
+func (c *Compiler) compileDestructuring(pattern ast.Pattern, strict bool) error {
+	strictOperand := 0
+	indexOp := code.OpIndex
+	if strict {
+		strictOperand = 1
+		indexOp = code.OpIndexStrict
+	}
+
+	switch pattern := pattern.(type) {
+	case *ast.ArrayPattern:
+		c.emit(code.OpDestructureArray, strictOperand)
+		for i, el := range pattern.Elements {
+			// a strict let still checks the element of a wildcard exists
+			if _, ok := el.(*ast.WildcardPattern); ok && !strict {
+				continue
+			}
+			c.emit(code.OpDup, 1)
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(i)}))
+			c.emit(indexOp)
+			err := c.bindDestructured(el, strict)
+			if err != nil {
+				return err
+			}
+		}
+
+		if pattern.Rest != nil {
+			symbol := c.symbolTable.Define(pattern.Rest.Value)
+			c.emit(code.OpDup, 1)
+			c.emit(code.OpSlice, len(pattern.Elements))
+			c.storeSymbol(symbol)
+		}
+
+	case *ast.HashPattern:
+		c.emit(code.OpDestructureHash, strictOperand)
+		for _, pair := range pattern.Pairs {
+			if _, ok := pair.Pattern.(*ast.WildcardPattern); ok && !strict {
+				continue
+			}
+			c.emit(code.OpDup, 1)
+			err := c.Compile(pair.Key)
+			if err != nil {
+				return err
+			}
+			c.emit(indexOp)
+			err = c.bindDestructured(pair.Pattern, strict)
+			if err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("%s: cannot bind to %s", pattern.Pos(), pattern.String())
+	}
+
+	return nil
+}
+
+// bindDestructured binds the names in a let pattern to the element at the top of the stack,
+// and pops it.
+func (c *Compiler) bindDestructured(pattern ast.Pattern, strict bool) error {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		c.emit(code.OpPop)
+		return nil
+
+	case *ast.IdentifierPattern:
+		c.storeSymbol(c.symbolTable.Define(pattern.Name.Value))
+		return nil
+
+	default:
+		err := c.compileDestructuring(pattern, strict)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+		return nil
+	}
+}
+
+// compoundOpcodes are the opcodes of the operators compound assignments apply.
+var compoundOpcodes = map[string]code.Opcode{
+	"+": code.OpAdd,
+	"-": code.OpSub,
+	"*": code.OpMul,
+	"/": code.OpDiv,
+}
+
+// compileAssignExpression compiles an assignment to a variable or an index.
+// The assigned value is left on the stack, as the result of the expression.
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	operator := node.BinaryOperator()
+	compound := operator != ""
+	compoundOp, ok := compoundOpcodes[operator]
+	if compound && !ok {
+		return fmt.Errorf("%s: unknown operator %s", node.Pos(), node.Operator)
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(target.Value)
+		if !ok {
+			return fmt.Errorf("%s: undefined variable %s", target.Pos(), target.Value)
+		}
+		switch {
+		case symbol.Scope == BuiltinScope:
+			return fmt.Errorf("%s: cannot assign to builtin %s", target.Pos(), target.Value)
+		case symbol.Scope == FreeScope && !symbol.Cell:
+			return fmt.Errorf("%s: cannot assign to captured variable %s", target.Pos(), target.Value)
+		}
+
+		if compound {
+			c.loadSymbol(symbol)
+		}
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		if compound {
+			c.emit(compoundOp)
+		}
+
+		c.storeSymbol(symbol)
+		c.loadSymbol(symbol)
+
+	case *ast.IndexExpression:
+		err := c.Compile(target.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(target.Index)
+		if err != nil {
+			return err
+		}
+
+		if compound {
+			// keep the collection and index for OpSetIndex, reading the current element from copies
+			c.emit(code.OpDup, 2)
+			c.emit(code.OpIndex)
+		}
+		err = c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		if compound {
+			c.emit(compoundOp)
+		}
+
+		c.emit(code.OpSetIndex)
+
+	default:
+		return fmt.Errorf("%s: cannot assign to %s", node.Pos(), node.Target.String())
+	}
+
+	return nil
+}
+
 func (c *Compiler) addConstant(obj object.Object) int {
 	c.constants = append(c.constants, obj)
 	return len(c.constants) - 1
@@ -331,9 +860,26 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	pos := c.addInstruction(inst)
 
 	c.setLastInstruction(op, pos)
+	c.addSourceMapping(pos)
 	return pos
 }
 
+// addSourceMapping records the position of the node being compiled for the instruction at pos.
+// A new entry is only added when the source position changes.
+func (c *Compiler) addSourceMapping(pos int) {
+	if !c.pos.IsValid() {
+		return
+	}
+
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	if n := len(sourceMap); n > 0 && sourceMap[n-1].Line == c.pos.Line && sourceMap[n-1].Column == c.pos.Column {
+		return
+	}
+
+	entry := code.SourceMapEntry{Offset: pos, Line: c.pos.Line, Column: c.pos.Column}
+	c.scopes[c.scopeIndex].sourceMap = append(sourceMap, entry)
+}
+
 func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
 	// save the current last instruction as a temp value
 	previous := c.scopes[c.scopeIndex].lastInstruction
@@ -355,6 +901,7 @@ func (c *Compiler) ByteCode() *ByteCode {
 	return &ByteCode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
 	}
 }
 
@@ -377,6 +924,13 @@ func (c *Compiler) removeLastPop() {
 
 	c.scopes[c.scopeIndex].instructions = new
 	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	// drop the source mappings of the removed instruction
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	for len(sourceMap) > 0 && sourceMap[len(sourceMap)-1].Offset >= last.Position {
+		sourceMap = sourceMap[:len(sourceMap)-1]
+	}
+	c.scopes[c.scopeIndex].sourceMap = sourceMap
 }
 
 // replaceInstruction replaces the instruction at the given position with the new instruction.
@@ -398,6 +952,7 @@ func (c *Compiler) changeOperand(opPos int, operand int) {
 type ByteCode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	SourceMap    code.SourceMap
 }
 
 func (c *Compiler) currentInstructions() code.Instructions {
@@ -424,22 +979,139 @@ func (c *Compiler) leaveScope() code.Instructions {
 	return instructions
 }
 
+// saveStackDepth emits the code storing the current stack depth in a hidden variable, one per
+// loop nesting depth, and returns the variable.
+func (c *Compiler) saveStackDepth() Symbol {
+	c.emit(code.OpStackDepth)
+	depth := c.symbolTable.Define(fmt.Sprintf("@depth%d", len(c.scopes[c.scopeIndex].loops)))
+	c.storeSymbol(depth)
+	return depth
+}
+
+// enterLoop starts compiling the body of a loop whose continue statements jump to continuePos.
+// depth is the variable saved by saveStackDepth before the loop.
+func (c *Compiler) enterLoop(continuePos int, depth Symbol) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, &loop{continuePos: continuePos, depth: depth})
+}
+
+// leaveLoop finishes the innermost loop, pointing its break statements and
+// the given exit jumps to the instruction after the loop.
+func (c *Compiler) leaveLoop(exitJumps ...int) {
+	scope := &c.scopes[c.scopeIndex]
+	loop := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	afterLoopPos := len(c.currentInstructions())
+	for _, pos := range append(exitJumps, loop.breakJumps...) {
+		c.changeOperand(pos, afterLoopPos)
+	}
+}
+
+// currentLoop returns the innermost loop in the current function, or nil outside of a loop.
+func (c *Compiler) currentLoop() *loop {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
 func (c *Compiler) replaceLastPopWithReturn() {
 	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
 	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
 }
 
+// defineCells defines the variables of the function that live in cells, see cellVariables.
+// It emits the code creating their cells when the function is called: parameters are moved
+// into their cell and the other variables start out as null.
+func (c *Compiler) defineCells(node *ast.FunctionLiteral) {
+	numParameters := len(node.Parameters)
+	if node.Rest != nil {
+		numParameters++
+	}
+
+	for _, name := range cellVariables(node) {
+		symbol := c.symbolTable.DefineCell(name)
+		if symbol.Index < numParameters {
+			c.emit(code.OpGetLocal, symbol.Index)
+		} else {
+			c.emit(code.OpNull)
+		}
+		c.emit(code.OpMakeCell, symbol.Index)
+	}
+}
+
+// compileDefaults emits the code filling the parameters a call leaves out with their default
+// values, each skipped if the call passed the parameter. It follows the cells of the function,
+// so the defaults see the earlier parameters as the body does.
+func (c *Compiler) compileDefaults(node *ast.FunctionLiteral) error {
+	firstDefault := len(node.Parameters) - len(node.Defaults)
+
+	for i, value := range node.Defaults {
+		index := firstDefault + i
+		// emit an OpJumpIfPassed with a bogus position, which is fixed after the default
+		jumpPos := c.emit(code.OpJumpIfPassed, 9999, index)
+
+		err := c.Compile(value)
+		if err != nil {
+			return err
+		}
+		symbol, _ := c.symbolTable.Resolve(node.Parameters[index].Value)
+		c.storeSymbol(symbol)
+
+		c.replaceInstruction(jumpPos, code.Make(code.OpJumpIfPassed, len(c.currentInstructions()), index))
+	}
+
+	return nil
+}
+
+// storeSymbol emits the instruction setting the variable s to the value at the top of the stack.
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch {
+	case s.Scope == GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case s.Scope == FreeScope:
+		c.emit(code.OpSetFreeCell, s.Index)
+	case s.Cell:
+		c.emit(code.OpSetLocalCell, s.Index)
+	default:
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+// loadCapture emits the instruction pushing what a closure captures for s: the variable's
+// cell if it lives in one, its value otherwise.
+func (c *Compiler) loadCapture(s Symbol) {
+	switch {
+	case s.Cell && s.Scope == LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case s.Cell && s.Scope == FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
 func (c *Compiler) loadSymbol(s Symbol) {
 	switch s.Scope {
 	case GlobalScope:
 		c.emit(code.OpGetGlobal, s.Index)
 	case LocalScope:
-		c.emit(code.OpGetLocal, s.Index)
+		if s.Cell {
+			c.emit(code.OpGetLocalCell, s.Index)
+		} else {
+			c.emit(code.OpGetLocal, s.Index)
+		}
 	case BuiltinScope:
 		c.emit(code.OpGetBuiltin, s.Index)
 	case FreeScope:
-		c.emit(code.OpGetFree, s.Index)
+		if s.Cell {
+			c.emit(code.OpGetFreeCell, s.Index)
+		} else {
+			c.emit(code.OpGetFree, s.Index)
+		}
 	case FunctionScope:
 		c.emit(code.OpCurrentClosure)
 	}
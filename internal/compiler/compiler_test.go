@@ -2,6 +2,7 @@ package compiler
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/natac13/monkey-compiler/internal/ast"
@@ -83,6 +84,32 @@ func TestIntegerArithmetic(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestFloatArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1.5 + 2",
+			expectedConstants: []interface{}{1.5, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-0.25",
+			expectedConstants: []interface{}{0.25},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -194,6 +221,96 @@ func TestBooleanExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestComparisonOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 >= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterThanEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 <= 2",
+			expectedConstants: []interface{}{2, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterThanEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "5 % 2",
+			expectedConstants: []interface{}{5, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0008
+				code.Make(code.OpTrue),
+				// 0009
+				code.Make(code.OpJump, 13),
+				// 0012
+				code.Make(code.OpFalse),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "true || false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 7),
+				// 0004
+				code.Make(code.OpJump, 11),
+				// 0007
+				code.Make(code.OpFalse),
+				// 0008
+				code.Make(code.OpJumpNotTruthy, 15),
+				// 0011
+				code.Make(code.OpTrue),
+				// 0012
+				code.Make(code.OpJump, 16),
+				// 0015
+				code.Make(code.OpFalse),
+				// 0016
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -249,6 +366,225 @@ func TestConditionals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestMatchExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			match (1) { 1 => 10, _ => 20 }
+			`,
+			expectedConstants: []interface{}{1, 1, 10, 20},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0), // subject
+				// 0003
+				code.Make(code.OpDup, 1),
+				// 0005
+				code.Make(code.OpConstant, 1),
+				// 0008
+				code.Make(code.OpEqual),
+				// 0009
+				code.Make(code.OpJumpNotTruthy, 19), // to the next arm
+				// 0012
+				code.Make(code.OpPop), // subject
+				// 0013
+				code.Make(code.OpConstant, 2),
+				// 0016
+				code.Make(code.OpJump, 28),
+				// 0019
+				code.Make(code.OpPop), // wildcard arm
+				// 0020
+				code.Make(code.OpConstant, 3),
+				// 0023
+				code.Make(code.OpJump, 28),
+				// 0026
+				code.Make(code.OpPop), // no arm matched
+				// 0027
+				code.Make(code.OpNull),
+				// 0028
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			match ([1]) { [a] => a }
+			`,
+			expectedConstants: []interface{}{1, 0},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpMatchArray, 1, 0),
+				// 0010
+				code.Make(code.OpJumpNotTruthy, 32),
+				// 0013
+				code.Make(code.OpDup, 1),
+				// 0015
+				code.Make(code.OpConstant, 1),
+				// 0018
+				code.Make(code.OpIndex),
+				// 0019
+				code.Make(code.OpDup, 1),
+				// 0021
+				code.Make(code.OpSetGlobal, 0),
+				// 0024
+				code.Make(code.OpPop), // element
+				// 0025
+				code.Make(code.OpPop), // subject
+				// 0026
+				code.Make(code.OpGetGlobal, 0),
+				// 0029
+				code.Make(code.OpJump, 34),
+				// 0032
+				code.Make(code.OpPop),
+				// 0033
+				code.Make(code.OpNull),
+				// 0034
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			while (true) { 1; }
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpStackDepth),
+				// 0001
+				code.Make(code.OpSetGlobal, 0), // the hidden stack depth variable
+				// 0004
+				code.Make(code.OpTrue), // condition
+				// 0005
+				code.Make(code.OpJumpNotTruthy, 15), // exit the loop
+				// 0008
+				code.Make(code.OpConstant, 0), // body
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpJump, 4), // back to the condition
+			},
+		},
+		{
+			input: `
+			while (true) { break; continue; }
+			`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpStackDepth),
+				// 0001
+				code.Make(code.OpSetGlobal, 0),
+				// 0004
+				code.Make(code.OpTrue),
+				// 0005
+				code.Make(code.OpJumpNotTruthy, 25),
+				// 0008
+				code.Make(code.OpGetGlobal, 0), // break
+				// 0011
+				code.Make(code.OpUnwindStack),
+				// 0012
+				code.Make(code.OpJump, 25),
+				// 0015
+				code.Make(code.OpGetGlobal, 0), // continue
+				// 0018
+				code.Make(code.OpUnwindStack),
+				// 0019
+				code.Make(code.OpJump, 4),
+				// 0022
+				code.Make(code.OpJump, 4),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			for (x in [1]) { x }
+			`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpGetIter),
+				// 0007
+				code.Make(code.OpSetGlobal, 0), // the hidden iterator variable
+				// 0010
+				code.Make(code.OpStackDepth),
+				// 0011
+				code.Make(code.OpSetGlobal, 1), // the hidden stack depth variable
+				// 0014
+				code.Make(code.OpGetGlobal, 0),
+				// 0017
+				code.Make(code.OpIterNext, 1), // next element
+				// 0019
+				code.Make(code.OpJumpNotTruthy, 32), // exit the loop
+				// 0022
+				code.Make(code.OpSetGlobal, 2), // x
+				// 0025
+				code.Make(code.OpGetGlobal, 2), // body
+				// 0028
+				code.Make(code.OpPop),
+				// 0029
+				code.Make(code.OpJump, 14), // back to the next element
+			},
+		},
+		{
+			input: `
+			for (k, v in "a") { break; }
+			`,
+			expectedConstants: []interface{}{"a"},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpGetIter),
+				// 0004
+				code.Make(code.OpSetGlobal, 0),
+				// 0007
+				code.Make(code.OpStackDepth),
+				// 0008
+				code.Make(code.OpSetGlobal, 1),
+				// 0011
+				code.Make(code.OpGetGlobal, 0),
+				// 0014
+				code.Make(code.OpIterNext, 2),
+				// 0016
+				code.Make(code.OpJumpNotTruthy, 35),
+				// 0019
+				code.Make(code.OpSetGlobal, 3), // v
+				// 0022
+				code.Make(code.OpSetGlobal, 2), // k
+				// 0025
+				code.Make(code.OpGetGlobal, 1), // break
+				// 0028
+				code.Make(code.OpUnwindStack),
+				// 0029
+				code.Make(code.OpJump, 35),
+				// 0032
+				code.Make(code.OpJump, 11),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestGlobalLetStatements(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -298,6 +634,223 @@ func TestGlobalLetStatements(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestAssignments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let x = 1;
+			x += 2;
+			`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			fn() { let x = 1; x = 2 }
+			`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let a = [1];
+			a[0] = 2;
+			a[0] *= 3;
+			`,
+			expectedConstants: []interface{}{1, 0, 2, 0, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpDup, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpMul),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let [a, b] = [1, 2];
+			b;
+			`,
+			expectedConstants: []interface{}{1, 2, 0, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpDestructureArray, 0),
+				code.Make(code.OpDup, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpDup, 1),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			fn(p) { let! {"x": x, "rest": [_, ...r]} = p; x }
+			`,
+			expectedConstants: []interface{}{
+				"x",
+				"rest",
+				0,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpDestructureHash, 1),
+					code.Make(code.OpDup, 1),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpIndexStrict),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpDup, 1),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpIndexStrict),
+					code.Make(code.OpDestructureArray, 1),
+					code.Make(code.OpDup, 1),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpIndexStrict),
+					code.Make(code.OpPop), // the wildcard's element
+					code.Make(code.OpDup, 1),
+					code.Make(code.OpSlice, 1),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpPop),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a, b = 10) { a + b }`,
+			expectedConstants: []interface{}{
+				10,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpJumpIfPassed, 9, 1),
+					// 0004
+					code.Make(code.OpConstant, 0),
+					// 0007
+					code.Make(code.OpSetLocal, 1),
+					// 0009
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(a, ...rest) { rest }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the default of a parameter in a cell is stored in the cell
+			input: `fn(a, b = a) { fn() { b += 1 } }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpSetFreeCell, 0),
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 1),
+					// 0002
+					code.Make(code.OpMakeCell, 1),
+					// 0004
+					code.Make(code.OpJumpIfPassed, 12, 1),
+					// 0008
+					code.Make(code.OpGetLocal, 0),
+					// 0010
+					code.Make(code.OpSetLocalCell, 1),
+					// 0012
+					code.Make(code.OpGetLocal, 1), // the cell itself
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestLetStatementScopes(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -901,6 +1454,80 @@ func TestClosures(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestCellVariables(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// captured but never changed, so copied into the closure
+		{"fn(a) { let b = 1; fn() { a + b } }", []string{}},
+		// changed but never captured
+		{"fn(a) { let b = 1; b = 2; a = 3; b }", []string{}},
+		{"fn(a) { let b = 1; fn() { a + b }; a += 1; b }", []string{"a"}},
+		{"fn(a) { let b = 1; let f = fn() { b = a }; f }", []string{"b"}},
+		{"fn() { let b = 1; let b = 2; fn() { b } }", []string{"b"}},
+		{"fn(xs) { for (x in xs) { fn() { x } } }", []string{"x"}},
+		{"fn() { while (true) { let y = 1; fn() { y } } }", []string{"y"}},
+		{"fn(p) { match (p) { [a, ...rest] if a > 0 => fn() { a + len(rest) } } }", []string{}},
+		{"fn(p) { match (p) { {\"a\": a, \"b\": [b]} => { fn() { a = b } } } }", []string{"a"}},
+		{"fn(ps) { for (p in ps) { match (p) { [a, ...rest] => fn() { rest } } } }", []string{"rest"}},
+		{"fn() { let [a, {\"b\": b}] = [1, {}]; b = 2; fn() { a + b } }", []string{"b"}},
+		{"fn(a, ...rest) { fn() { rest = a } }", []string{"rest"}},
+		{"fn(a, b = fn() { a }) { a = 1; b }", []string{"a"}},
+		{"fn(a = fn() { b }, b = 1) { a }", []string{"b"}},
+		{"fn(a = 1, b = 2) { fn() { a + b } }", []string{}},
+		// captured through an intermediate function
+		{"fn() { let n = 0; fn() { fn() { n += 1 } } }", []string{"n"}},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+
+		cells := cellVariables(fn)
+		if strings.Join(cells, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("wrong cell variables for %q. want=%v, got=%v", tt.input, tt.expected, cells)
+		}
+	}
+}
+
+func TestCellClosures(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			fn() { let n = 0; fn() { n += 1 } }
+			`,
+			expectedConstants: []interface{}{
+				0,
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpSetFreeCell, 0),
+					code.Make(code.OpGetFreeCell, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpNull),
+					code.Make(code.OpMakeCell, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocalCell, 0),
+					code.Make(code.OpGetLocal, 0), // the cell itself
+					code.Make(code.OpClosure, 2, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestRecursiveFunctions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -970,6 +1597,94 @@ func TestRecursiveFunctions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestSourceMap(t *testing.T) {
+	input := `let one = 1;
+let f = fn() {
+  one + 2
+};`
+
+	program := parse(input)
+	compiler := New()
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.ByteCode()
+
+	expectedMain := code.SourceMap{
+		// OpConstant 0 (1)
+		{Offset: 0, Line: 1, Column: 11},
+		// OpSetGlobal 0
+		{Offset: 3, Line: 1, Column: 1},
+		// OpClosure 2 0
+		{Offset: 6, Line: 2, Column: 9},
+		// OpSetGlobal 1
+		{Offset: 10, Line: 2, Column: 1},
+	}
+	testSourceMap(t, expectedMain, bytecode.SourceMap)
+
+	fn, ok := bytecode.Constants[2].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 2 is not a function. got=%T", bytecode.Constants[2])
+	}
+	if fn.Name != "f" {
+		t.Errorf("function has wrong name. want=%q, got=%q", "f", fn.Name)
+	}
+
+	expectedFn := code.SourceMap{
+		// OpGetGlobal 0
+		{Offset: 0, Line: 3, Column: 3},
+		// OpConstant 1 (2)
+		{Offset: 3, Line: 3, Column: 9},
+		// OpAdd
+		{Offset: 6, Line: 3, Column: 7},
+		// OpReturnValue, replacing the expression statement's OpPop
+		{Offset: 7, Line: 3, Column: 3},
+	}
+	testSourceMap(t, expectedFn, fn.SourceMap)
+}
+
+func testSourceMap(t *testing.T, expected, actual code.SourceMap) {
+	t.Helper()
+
+	if len(expected) != len(actual) {
+		t.Fatalf("wrong source map length. want=%+v, got=%+v", expected, actual)
+	}
+
+	for i, entry := range expected {
+		if actual[i] != entry {
+			t.Errorf("wrong source map entry %d. want=%+v, got=%+v", i, entry, actual[i])
+		}
+	}
+}
+
+func TestCompilerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x", "1:1: undefined variable x"},
+		{"let a = 1;\nlet f = fn() {\n  a + b;\n};", "3:7: undefined variable b"},
+		{"y = 1;", "1:1: undefined variable y"},
+		{"len = 1;", "1:1: cannot assign to builtin len"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("expected compiler error for %q, got nil", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
 
@@ -1045,6 +1760,11 @@ func testConstants(
 			if err != nil {
 				return err
 			}
+		case float64:
+			err := testFloatObject(constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testFloatObject failed: %s", i, err)
+			}
 		case string:
 			err := testStringObject(constant, actual[i])
 			if err != nil {
@@ -1078,6 +1798,19 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%f, want=%f", result.Value, expected)
+	}
+
+	return nil
+}
+
 func testStringObject(expected string, actual object.Object) error {
 	result, ok := actual.(*object.String)
 	if !ok {
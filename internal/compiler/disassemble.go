@@ -0,0 +1,83 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/natac13/monkey-compiler/internal/code"
+	"github.com/natac13/monkey-compiler/internal/object"
+)
+
+// Disassemble lists the main program followed by every compiled function in the
+// constant pool. Operands that refer to constants or standard builtins are annotated inline.
+func Disassemble(bytecode *ByteCode) string {
+	return DisassembleWithBuiltins(bytecode, object.NewRegistry())
+}
+
+// DisassembleWithBuiltins is like Disassemble for bytecode compiled against a custom registry.
+func DisassembleWithBuiltins(bytecode *ByteCode, builtins *object.Registry) string {
+	var out bytes.Buffer
+	annotate := constantAnnotator(bytecode.Constants, builtins.Names())
+
+	fmt.Fprintln(&out, "== <main> ==")
+	out.WriteString(bytecode.Instructions.Format(annotate))
+
+	for i, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		fmt.Fprintf(&out, "\n== %s (constant %d) NumLocals=%d NumParameters=%d",
+			functionName(fn), i, fn.NumLocals, fn.NumParameters)
+		if fn.NumDefaults > 0 {
+			fmt.Fprintf(&out, " NumDefaults=%d", fn.NumDefaults)
+		}
+		if fn.Variadic {
+			out.WriteString(" Variadic")
+		}
+		out.WriteString(" ==\n")
+		out.WriteString(fn.Instructions.Format(annotate))
+	}
+
+	return out.String()
+}
+
+func constantAnnotator(constants []object.Object, builtinNames []string) code.Annotator {
+	return func(op code.Opcode, operands []int) string {
+		switch op {
+		case code.OpConstant, code.OpClosure:
+			if operands[0] >= len(constants) {
+				return "<invalid constant>"
+			}
+			return describeConstant(constants[operands[0]])
+
+		case code.OpGetBuiltin:
+			if operands[0] >= len(builtinNames) {
+				return "<invalid builtin>"
+			}
+			return builtinNames[operands[0]]
+		}
+
+		return ""
+	}
+}
+
+func describeConstant(constant object.Object) string {
+	switch constant := constant.(type) {
+	case *object.String:
+		return strconv.Quote(constant.Value)
+	case *object.CompiledFunction:
+		return "fn " + functionName(constant)
+	default:
+		return constant.Inspect()
+	}
+}
+
+func functionName(fn *object.CompiledFunction) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
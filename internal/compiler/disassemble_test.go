@@ -0,0 +1,39 @@
+package compiler
+
+import "testing"
+
+func TestDisassemble(t *testing.T) {
+	input := `let greet = fn(name) { puts("hi " + name) }; greet(fn() { 1 }());`
+
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := `== <main> ==
+0000 OpClosure 1 0 ; fn greet
+0004 OpSetGlobal 0
+0007 OpGetGlobal 0
+0010 OpClosure 3 0 ; fn <anonymous>
+0014 OpCall 0
+0016 OpCall 1
+0018 OpPop
+
+== greet (constant 1) NumLocals=1 NumParameters=1 ==
+0000 OpGetBuiltin 1 ; puts
+0002 OpConstant 0 ; "hi "
+0005 OpGetLocal 0
+0007 OpAdd
+0008 OpCall 1
+0010 OpReturnValue
+
+== <anonymous> (constant 3) NumLocals=0 NumParameters=0 ==
+0000 OpConstant 2 ; 1
+0003 OpReturnValue
+`
+
+	if actual := Disassemble(compiler.ByteCode()); actual != expected {
+		t.Errorf("wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, actual)
+	}
+}
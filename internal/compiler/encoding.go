@@ -0,0 +1,303 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/natac13/monkey-compiler/internal/code"
+	"github.com/natac13/monkey-compiler/internal/object"
+)
+
+// FormatVersion is the version of the .mkc bytecode format written by Encode.
+// Bump it whenever the layout, the opcode numbering or the builtin order changes.
+const FormatVersion = 2
+
+// magic identifies a serialized ByteCode file.
+var magic = []byte("MKC\x00")
+
+// constant tags used in the serialized constant pool
+const (
+	tagInteger          byte = 'i'
+	tagFloat            byte = 'f'
+	tagString           byte = 's'
+	tagCompiledFunction byte = 'c'
+)
+
+// ErrInvalidFormat is returned by Decode when the input is not a valid .mkc file.
+var ErrInvalidFormat = errors.New("invalid bytecode format")
+
+// The layout of a .mkc file is:
+//
+//	magic "MKC\0" | version uint16 | instructions | source map | constants
+//
+// Instructions are a uvarint length followed by the raw bytes. A source map is a
+// uvarint count followed by uvarint offset, line and column triples. The constant
+// pool is a uvarint count followed by one tagged entry per constant.
+
+// Encode writes the bytecode to w in the versioned .mkc format.
+func (b *ByteCode) Encode(w io.Writer) error {
+	var buf bytes.Buffer
+
+	buf.Write(magic)
+	binary.Write(&buf, binary.BigEndian, uint16(FormatVersion))
+
+	writeInstructions(&buf, b.Instructions)
+	writeSourceMap(&buf, b.SourceMap)
+
+	writeUvarint(&buf, uint64(len(b.Constants)))
+	for i, constant := range b.Constants {
+		err := writeConstant(&buf, constant)
+		if err != nil {
+			return fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeConstant(buf *bytes.Buffer, constant object.Object) error {
+	switch constant := constant.(type) {
+	case *object.Integer:
+		buf.WriteByte(tagInteger)
+		var tmp [binary.MaxVarintLen64]byte
+		n := binary.PutVarint(tmp[:], constant.Value)
+		buf.Write(tmp[:n])
+
+	case *object.Float:
+		buf.WriteByte(tagFloat)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(constant.Value))
+
+	case *object.String:
+		buf.WriteByte(tagString)
+		writeString(buf, constant.Value)
+
+	case *object.CompiledFunction:
+		buf.WriteByte(tagCompiledFunction)
+		writeString(buf, constant.Name)
+		writeUvarint(buf, uint64(constant.NumLocals))
+		writeUvarint(buf, uint64(constant.NumParameters))
+		writeUvarint(buf, uint64(constant.NumDefaults))
+		writeBool(buf, constant.Variadic)
+		writeInstructions(buf, constant.Instructions)
+		writeSourceMap(buf, constant.SourceMap)
+
+	default:
+		return fmt.Errorf("cannot encode constant of type %s", constant.Type())
+	}
+
+	return nil
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
+
+func writeBool(buf *bytes.Buffer, b bool) {
+	if b {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeUvarint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func writeInstructions(buf *bytes.Buffer, ins code.Instructions) {
+	writeUvarint(buf, uint64(len(ins)))
+	buf.Write(ins)
+}
+
+func writeSourceMap(buf *bytes.Buffer, sourceMap code.SourceMap) {
+	writeUvarint(buf, uint64(len(sourceMap)))
+	for _, entry := range sourceMap {
+		writeUvarint(buf, uint64(entry.Offset))
+		writeUvarint(buf, uint64(entry.Line))
+		writeUvarint(buf, uint64(entry.Column))
+	}
+}
+
+// Decode reads bytecode in the .mkc format written by Encode.
+func Decode(r io.Reader) (*ByteCode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &decoder{r: bytes.NewReader(data)}
+
+	header := make([]byte, len(magic))
+	d.read(header)
+	if d.err != nil || !bytes.Equal(header, magic) {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidFormat)
+	}
+
+	var version uint16
+	d.read(&version)
+	if d.err == nil && version != FormatVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d, want %d", ErrInvalidFormat, version, FormatVersion)
+	}
+
+	bytecode := &ByteCode{
+		Instructions: d.instructions(),
+		SourceMap:    d.sourceMap(),
+	}
+
+	numConstants := d.length()
+	bytecode.Constants = make([]object.Object, 0, numConstants)
+	for i := 0; i < numConstants && d.err == nil; i++ {
+		bytecode.Constants = append(bytecode.Constants, d.constant())
+	}
+
+	if d.err == nil && d.r.Len() != 0 {
+		d.fail("%d trailing bytes", d.r.Len())
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return bytecode, nil
+}
+
+// decoder reads the .mkc format, keeping the first error so callers can check once at the end.
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrInvalidFormat, fmt.Sprintf(format, a...))
+	}
+}
+
+func (d *decoder) read(data interface{}) {
+	if d.err != nil {
+		return
+	}
+	err := binary.Read(d.r, binary.BigEndian, data)
+	if err != nil {
+		d.fail("unexpected end of input")
+	}
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.fail("bad varint")
+	}
+	return v
+}
+
+// length reads a uvarint that sizes something still to come in the input.
+// Every counted item takes at least one byte, so it can't exceed the remaining input.
+func (d *decoder) length() int {
+	v := d.uvarint()
+	if v > uint64(d.r.Len()) {
+		d.fail("length %d exceeds remaining input", v)
+		return 0
+	}
+	return int(v)
+}
+
+// int reads a uvarint that is stored in an int field.
+func (d *decoder) int() int {
+	v := d.uvarint()
+	if v > math.MaxInt32 {
+		d.fail("value %d out of range", v)
+		return 0
+	}
+	return int(v)
+}
+
+func (d *decoder) bool() bool {
+	var b byte
+	d.read(&b)
+	if b > 1 {
+		d.fail("bad bool %d", b)
+	}
+	return b == 1
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.length()
+	if d.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	d.read(b)
+	return b
+}
+
+func (d *decoder) instructions() code.Instructions {
+	return code.Instructions(d.bytes())
+}
+
+func (d *decoder) sourceMap() code.SourceMap {
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+
+	sourceMap := make(code.SourceMap, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		sourceMap = append(sourceMap, code.SourceMapEntry{
+			Offset: d.int(),
+			Line:   d.int(),
+			Column: d.int(),
+		})
+	}
+	return sourceMap
+}
+
+func (d *decoder) constant() object.Object {
+	var tag byte
+	d.read(&tag)
+	if d.err != nil {
+		return nil
+	}
+
+	switch tag {
+	case tagInteger:
+		v, err := binary.ReadVarint(d.r)
+		if err != nil {
+			d.fail("bad varint")
+		}
+		return &object.Integer{Value: v}
+
+	case tagFloat:
+		var bits uint64
+		d.read(&bits)
+		return &object.Float{Value: math.Float64frombits(bits)}
+
+	case tagString:
+		return &object.String{Value: string(d.bytes())}
+
+	case tagCompiledFunction:
+		return &object.CompiledFunction{
+			Name:          string(d.bytes()),
+			NumLocals:     d.int(),
+			NumParameters: d.int(),
+			NumDefaults:   d.int(),
+			Variadic:      d.bool(),
+			Instructions:  d.instructions(),
+			SourceMap:     d.sourceMap(),
+		}
+
+	default:
+		d.fail("unknown constant tag %q", tag)
+		return nil
+	}
+}
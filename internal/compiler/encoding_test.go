@@ -0,0 +1,91 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/natac13/monkey-compiler/internal/object"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	input := `
+	let greeting = "hello\n";
+	let ratio = 0.25;
+	let makeAdder = fn(a) { fn(b) { a + b * -7 } };
+	let add = makeAdder(1);
+	let sum = fn(a, b = 2, ...rest) { a + b + len(rest) };
+	puts(greeting, ratio, add(2));
+	`
+
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.ByteCode()
+
+	var buf bytes.Buffer
+	err = bytecode.Encode(&buf)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+
+	if !bytes.Equal(decoded.Instructions, bytecode.Instructions) {
+		t.Errorf("wrong instructions.\nwant=%q\ngot=%q", bytecode.Instructions, decoded.Instructions)
+	}
+	testSourceMap(t, bytecode.SourceMap, decoded.SourceMap)
+
+	if len(decoded.Constants) != len(bytecode.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d",
+			len(bytecode.Constants), len(decoded.Constants))
+	}
+	for i, want := range bytecode.Constants {
+		if !reflect.DeepEqual(decoded.Constants[i], want) {
+			t.Errorf("constant %d wrong. want=%#v, got=%#v", i, want, decoded.Constants[i])
+		}
+	}
+}
+
+func TestEncodeUnsupportedConstant(t *testing.T) {
+	bytecode := &ByteCode{Constants: []object.Object{&object.Boolean{Value: true}}}
+
+	err := bytecode.Encode(&bytes.Buffer{})
+	if err == nil || err.Error() != "constant 0: cannot encode constant of type BOOLEAN" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var valid bytes.Buffer
+	err := (&ByteCode{Constants: []object.Object{&object.String{Value: "monkey"}}}).Encode(&valid)
+	if err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	data := valid.Bytes()
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{"empty", []byte{}},
+		{"bad magic", []byte("ELF\x00\x00\x01")},
+		{"wrong version", append([]byte("MKC\x00\x00\x63"), data[6:]...)},
+		{"truncated", data[:len(data)-2]},
+		{"trailing bytes", append(append([]byte{}, data...), 0)},
+		{"unknown tag", append(append([]byte{}, data[:len(data)-8]...), 'x')},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.input))
+		if !errors.Is(err, ErrInvalidFormat) {
+			t.Errorf("%s: expected ErrInvalidFormat, got=%v", tt.name, err)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package compiler
 
+import "github.com/natac13/monkey-compiler/internal/object"
+
 type SymbolScope string
 
 const (
@@ -14,6 +16,8 @@ type Symbol struct {
 	Name  string
 	Scope SymbolScope
 	Index int
+	// Cell is set for local and free variables living in a cell shared with closures, see DefineCell
+	Cell bool
 }
 
 type SymbolTable struct {
@@ -36,6 +40,8 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
+// Define defines name in this table. Defining a name again in the same table
+// reuses its slot, so `let x = x + 1;` updates x like it does in the evaluator.
 func (s *SymbolTable) Define(name string) Symbol {
 	symbol := Symbol{Name: name, Index: s.numDefinitions}
 	if s.Outer == nil {
@@ -43,11 +49,29 @@ func (s *SymbolTable) Define(name string) Symbol {
 	} else {
 		symbol.Scope = LocalScope
 	}
+	if existing, ok := s.store[name]; ok && existing.Scope == symbol.Scope {
+		return existing
+	}
 	s.store[name] = symbol
 	s.numDefinitions++
 	return symbol
 }
 
+// Clone returns a copy of the table, sharing its outer tables, so names can be defined
+// in the copy and thrown away, e.g. when compiling fails.
+func (s *SymbolTable) Clone() *SymbolTable {
+	clone := &SymbolTable{
+		Outer:          s.Outer,
+		store:          make(map[string]Symbol, len(s.store)),
+		numDefinitions: s.numDefinitions,
+		FreeSymbols:    append([]Symbol{}, s.FreeSymbols...),
+	}
+	for name, symbol := range s.store {
+		clone.store[name] = symbol
+	}
+	return clone
+}
+
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
 	if !ok && s.Outer != nil {
@@ -66,15 +90,32 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	return obj, ok
 }
 
+// DefineCell defines name as a local living in a cell, or turns the local already defined
+// with that name into one. Closures capture the cell instead of a copy of the value, so
+// assignments are seen by the function and all its closures.
+func (s *SymbolTable) DefineCell(name string) Symbol {
+	symbol := s.Define(name)
+	symbol.Cell = true
+	s.store[name] = symbol
+	return symbol
+}
+
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
 	s.store[name] = symbol
 	return symbol
 }
 
+// DefineBuiltins defines every builtin of the registry, so their names resolve to BuiltinScope.
+func (s *SymbolTable) DefineBuiltins(builtins *object.Registry) {
+	for i, name := range builtins.Names() {
+		s.DefineBuiltin(i, name)
+	}
+}
+
 func (s *SymbolTable) defineFree(original Symbol) Symbol {
 	s.FreeSymbols = append(s.FreeSymbols, original)
-	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Cell: original.Cell}
 	symbol.Scope = FreeScope
 	s.store[original.Name] = symbol
 	return symbol
@@ -45,6 +45,36 @@ func TestDefine(t *testing.T) {
 	}
 }
 
+func TestRedefine(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.Define("b")
+
+	redefined := global.Define("a")
+	expected := Symbol{Name: "a", Scope: GlobalScope, Index: 0}
+	if redefined != expected {
+		t.Errorf("expected a=%+v, got=%+v", expected, redefined)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	local.DefineFunctionName("f")
+	local.Resolve("b")
+	local.Define("c")
+
+	tests := []Symbol{
+		{Name: "a", Scope: LocalScope, Index: 1},
+		{Name: "b", Scope: LocalScope, Index: 2},
+		{Name: "f", Scope: LocalScope, Index: 3},
+		{Name: "c", Scope: LocalScope, Index: 0},
+	}
+	for _, sym := range tests {
+		result := local.Define(sym.Name)
+		if result != sym {
+			t.Errorf("expected %s=%+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+}
+
 func TestResolveGlobal(t *testing.T) {
 	global := NewSymbolTable()
 	global.Define("a")
@@ -317,3 +347,21 @@ func TestShadowingFunctionName(t *testing.T) {
 		t.Errorf("expected s=a to resolve to %+v, got=%+v", expected, result)
 	}
 }
+
+func TestClone(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	clone := global.Clone()
+	clone.Define("b")
+	if symbol := clone.Define("c"); symbol.Index != 2 {
+		t.Errorf("expected c to get index 2, got=%d", symbol.Index)
+	}
+
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("expected b not to be defined in the original table")
+	}
+	if symbol := global.Define("d"); symbol.Index != 1 {
+		t.Errorf("expected d to get index 1, got=%d", symbol.Index)
+	}
+}
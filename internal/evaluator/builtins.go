@@ -1,14 +1,38 @@
 package evaluator
 
 import (
+	"errors"
+
 	"github.com/natac13/monkey-compiler/internal/object"
 )
 
-var builtins = map[string]*object.Builtin{
-	"len":   object.GetBuiltinByName("len"),
-	"puts":  object.GetBuiltinByName("puts"),
-	"first": object.GetBuiltinByName("first"),
-	"last":  object.GetBuiltinByName("last"),
-	"rest":  object.GetBuiltinByName("rest"),
-	"push":  object.GetBuiltinByName("push"),
+// builtins are the standard builtins, looked up by name when an identifier isn't bound.
+var builtins = object.NewRegistry()
+
+// evalHost lets builtins call back into functions while evaluating.
+type evalHost struct {
+	env *object.Environment
+	// err is the error of the first failed Call, which applyFunction returns instead of
+	// the builtin's result, as the failure is fatal
+	err *object.Error
+}
+
+func (h *evalHost) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	result := applyFunction(fn, args, h.env)
+	if errObj, ok := result.(*object.Error); ok {
+		if h.err == nil {
+			h.err = errObj
+		}
+		return nil, errors.New(errObj.Message)
+	}
+	return result, nil
+}
+
+func (h *evalHost) IO() *object.IO {
+	return h.env.IO()
+}
+
+// Allocate doesn't limit memory, as the evaluator has no resource limits.
+func (h *evalHost) Allocate(size int64) error {
+	return nil
 }
@@ -2,6 +2,7 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/natac13/monkey-compiler/internal/ast"
 	"github.com/natac13/monkey-compiler/internal/object"
@@ -11,6 +12,9 @@ var (
 	NULL  = &object.Null{}
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
@@ -28,22 +32,46 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
 
+	case *ast.DestructuringLetStatement:
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		if err := destructure(node.Pattern, val, node.Strict, env); err != nil {
+			return err
+		}
+
 	// Expression
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
@@ -52,7 +80,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
@@ -60,31 +88,37 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
 		index := Eval(node.Index, env)
-		if isError(index) {
+		if isAbrupt(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
 
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
@@ -92,26 +126,29 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Parameters: params, Defaults: node.Defaults, Rest: node.Rest, Body: body, Env: env}
 
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
-		if isError(function) {
+		if isAbrupt(function) {
 			return function
 		}
 
 		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		return applyFunction(function, args, env)
 	}
 
 	return nil
@@ -142,7 +179,8 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -151,6 +189,261 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+
+	iterator, ok := object.NewIterator(iterable)
+	if !ok {
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	for {
+		if len(fs.Variables) == 1 {
+			value, ok := iterator.Next()
+			if !ok {
+				return NULL
+			}
+			env.Set(fs.Variables[0].Value, value)
+		} else {
+			key, value, ok := iterator.NextPair()
+			if !ok {
+				return NULL
+			}
+			env.Set(fs.Variables[0].Value, key)
+			env.Set(fs.Variables[1].Value, value)
+		}
+
+		result := Eval(fs.Body, env)
+		if result != nil {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+				return result
+			case object.BREAK_OBJ:
+				return NULL
+			}
+		}
+	}
+}
+
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(me.Subject, env)
+	if isAbrupt(subject) {
+		return subject
+	}
+
+	for _, arm := range me.Arms {
+		matched := matchPattern(arm.Pattern, subject, env)
+		if isError(matched) {
+			return matched
+		}
+		if matched != TRUE {
+			continue
+		}
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, env)
+			if isAbrupt(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		result := Eval(arm.Body, env)
+		if result == nil {
+			return NULL
+		}
+		return result
+	}
+
+	return NULL
+}
+
+// matchPattern returns TRUE if value matches the pattern and FALSE if it doesn't,
+// or an error. The names in the pattern are bound in env as they are reached.
+func matchPattern(pattern ast.Pattern, value object.Object, env *object.Environment) object.Object {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return TRUE
+
+	case *ast.IdentifierPattern:
+		env.Set(pattern.Name.Value, value)
+		return TRUE
+
+	case *ast.LiteralPattern:
+		literal := Eval(pattern.Value, env)
+		if isError(literal) {
+			return literal
+		}
+		return nativeBoolToBooleanObject(isTruthy(evalInfixExpression("==", value, literal)))
+
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok {
+			return FALSE
+		}
+		length := len(pattern.Elements)
+		if len(array.Elements) < length || !pattern.HasRest && len(array.Elements) > length {
+			return FALSE
+		}
+
+		for i, el := range pattern.Elements {
+			matched := matchPattern(el, array.Elements[i], env)
+			if matched != TRUE {
+				return matched
+			}
+		}
+
+		if pattern.Rest != nil {
+			rest := make([]object.Object, len(array.Elements)-length)
+			copy(rest, array.Elements[length:])
+			env.Set(pattern.Rest.Value, &object.Array{Elements: rest})
+		}
+		return TRUE
+
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return FALSE
+		}
+
+		for _, pair := range pattern.Pairs {
+			key := Eval(pair.Key, env)
+			if isError(key) {
+				return key
+			}
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", key.Type())
+			}
+			hashPair, ok := hash.Pairs[hashKey.HashKey()]
+			if !ok {
+				return FALSE
+			}
+
+			matched := matchPattern(pair.Pattern, hashPair.Value, env)
+			if matched != TRUE {
+				return matched
+			}
+		}
+		return TRUE
+
+	default:
+		return newError("unknown pattern: %s", pattern.String())
+	}
+}
+
+// destructure binds the names in a let pattern to the parts of value in env. Missing elements
+// and keys, and the parts of null, are bound to null unless strict. It returns an error, or
+// nil if the names were bound.
+func destructure(pattern ast.Pattern, value object.Object, strict bool, env *object.Environment) *object.Error {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return nil
+
+	case *ast.IdentifierPattern:
+		env.Set(pattern.Name.Value, value)
+		return nil
+
+	case *ast.ArrayPattern:
+		var elements []object.Object
+		switch value := value.(type) {
+		case *object.Array:
+			elements = value.Elements
+		case *object.Null:
+			if strict {
+				return newError("cannot destructure %s as %s", value.Type(), object.ARRAY_OBJ)
+			}
+		default:
+			return newError("cannot destructure %s as %s", value.Type(), object.ARRAY_OBJ)
+		}
+
+		for i, el := range pattern.Elements {
+			var element object.Object = NULL
+			if i < len(elements) {
+				element = elements[i]
+			} else if strict {
+				return newError("index out of range: %d with length %d", i, len(elements))
+			}
+			if err := destructure(el, element, strict, env); err != nil {
+				return err
+			}
+		}
+
+		if pattern.Rest != nil {
+			rest := []object.Object{}
+			if len(elements) > len(pattern.Elements) {
+				rest = append(rest, elements[len(pattern.Elements):]...)
+			}
+			env.Set(pattern.Rest.Value, &object.Array{Elements: rest})
+		}
+		return nil
+
+	case *ast.HashPattern:
+		var pairs map[object.HashKey]object.HashPair
+		switch value := value.(type) {
+		case *object.Hash:
+			pairs = value.Pairs
+		case *object.Null:
+			if strict {
+				return newError("cannot destructure %s as %s", value.Type(), object.HASH_OBJ)
+			}
+		default:
+			return newError("cannot destructure %s as %s", value.Type(), object.HASH_OBJ)
+		}
+
+		for _, pair := range pattern.Pairs {
+			key := Eval(pair.Key, env)
+			if isError(key) {
+				return key.(*object.Error)
+			}
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", key.Type())
+			}
+
+			var element object.Object = NULL
+			if hashPair, ok := pairs[hashKey.HashKey()]; ok {
+				element = hashPair.Value
+			} else if strict {
+				return newError("missing key %s", key.Inspect())
+			}
+			if err := destructure(pair.Pattern, element, strict, env); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return newError("cannot bind to %s", pattern.String())
+	}
+}
+
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		result := Eval(ws.Body, env)
+		if result != nil {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+				return result
+			case object.BREAK_OBJ:
+				return NULL
+			}
+		}
+	}
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
@@ -183,18 +476,26 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	// mixed integer and float operands are promoted to float
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
+	// strings are compared by value, so they're handled before the pointer comparison below
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
 	// we can compare the objects directly because we have a single instance of TRUE and FALSE and NULL
 	// and we reference a pointer of them
 	// this will make boolean comparison work faster than integers which have to be
@@ -206,13 +507,33 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 		return nativeBoolToBooleanObject(left != right)
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
+// evalLogicalExpression evaluates && and ||, only evaluating the right side when needed.
+// The result is always TRUE or FALSE.
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+	if isAbrupt(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
@@ -225,11 +546,23 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -239,9 +572,58 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	t := obj.Type()
+	return t == object.INTEGER_OBJ || t == object.FLOAT_OBJ
+}
+
+// toFloat converts an Integer or Float to a float64. Callers check isNumber first.
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Float:
+		return obj.Value
+	case *object.Integer:
+		return float64(obj.Value)
+	default:
+		return 0
+	}
+}
+
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+	if isAbrupt(condition) {
 		return condition
 	}
 	if isTruthy(condition) {
@@ -258,7 +640,7 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := builtins.Lookup(node.Value); ok {
 		return builtin
 	}
 
@@ -273,7 +655,7 @@ func evalExpressions(
 
 	for _, e := range exps {
 		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -286,14 +668,20 @@ func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	if operator != "+" {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
 		return newError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
-
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
 }
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
@@ -313,7 +701,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 
 	for keyNode, valueNode := range node.Pairs {
 		key := Eval(keyNode, env)
-		if isError(key) {
+		if isAbrupt(key) {
 			return key
 		}
 
@@ -323,7 +711,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 		}
 
 		value := Eval(valueNode, env)
-		if isError(value) {
+		if isAbrupt(value) {
 			return value
 		}
 
@@ -345,6 +733,103 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	}
 }
 
+// evalAssignExpression assigns to a variable or an index and returns the assigned value.
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	operator := node.BinaryOperator()
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		var current object.Object
+		if operator != "" {
+			current = evalIdentifier(target, env)
+			if isAbrupt(current) {
+				return current
+			}
+		}
+
+		value := evalAssignedValue(node, current, env)
+		if isAbrupt(value) {
+			return value
+		}
+
+		if !env.Assign(target.Value, value) {
+			if _, ok := builtins.Lookup(target.Value); ok {
+				return newError("cannot assign to builtin %s", target.Value)
+			}
+			return newError("identifier not found: " + target.Value)
+		}
+		return value
+
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+
+		var current object.Object
+		if operator != "" {
+			current = evalIndexExpression(left, index)
+			if isAbrupt(current) {
+				return current
+			}
+		}
+
+		value := evalAssignedValue(node, current, env)
+		if isAbrupt(value) {
+			return value
+		}
+		return evalSetIndexExpression(left, index, value)
+
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+// evalAssignedValue evaluates the value of an assignment, applying the operator of
+// a compound assignment to the current value of its target.
+func evalAssignedValue(node *ast.AssignExpression, current object.Object, env *object.Environment) object.Object {
+	value := Eval(node.Value, env)
+	if isAbrupt(value) {
+		return value
+	}
+
+	operator := node.BinaryOperator()
+	if operator == "" {
+		return value
+	}
+	return evalInfixExpression(operator, current, value)
+}
+
+func evalSetIndexExpression(left, index, value object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %d with length %d", i.Value, len(left.Elements))
+		}
+		left.Elements[i.Value] = value
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+
+	return value
+}
+
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 	key, ok := index.(object.Hashable)
@@ -381,12 +866,34 @@ func isError(obj object.Object) bool {
 	return obj != nil && obj.Type() == object.ERROR_OBJ
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// isAbrupt reports whether obj stops the evaluation of the expression it came from: an error,
+// or a return, break or continue inside it, which is passed up to its function or loop.
+func isAbrupt(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	switch obj.Type() {
+	case object.ERROR_OBJ, object.RETURN_VALUE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+		return true
+	default:
+		return false
+	}
+}
+
+// applyFunction calls fn with args. env is the environment of the call, used by builtins for IO.
+func applyFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
 
 	switch fn := fn.(type) {
 
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
+		if len(args) < len(fn.Parameters)-len(fn.Defaults) || len(args) > len(fn.Parameters) && fn.Rest == nil {
+			return newError("wrong number of arguments: want=%s, got=%d", arity(fn), len(args))
+		}
+		extendedEnv, err := extendFunctionEnv(fn, args)
+		if err != nil {
+			// a return inside a default returns from the function
+			return unwrapReturnValue(err)
+		}
 		evaluated := Eval(fn.Body, extendedEnv)
 		// we need to unwrap the return value if it is a ReturnValue object
 		// so that we can return the value inside it
@@ -394,7 +901,12 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 		return unwrapReturnValue(evaluated)
 
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
+		host := &evalHost{env: env}
+		result := fn.Fn(host, args...)
+		if host.err != nil {
+			return host.err
+		}
+		if result != nil {
 			return result
 		}
 		return NULL
@@ -404,17 +916,56 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 	}
 }
 
+// extendFunctionEnv binds the parameters of fn to args in a new environment. The extra
+// arguments are bound to the rest parameter, and the parameters left out to their defaults.
+// The defaults are evaluated in the new environment from left to right, with the parameters
+// not set yet bound to null, as in the VM. It returns the error, or the return value, that
+// stopped a default.
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
-) *object.Environment {
+) (*object.Environment, object.Object) {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.Set(fn.Rest.Value, &object.Array{Elements: rest})
+	}
+
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		if paramIdx < len(args) {
+			env.Set(param.Value, args[paramIdx])
+		} else {
+			env.Set(param.Value, NULL)
+		}
+	}
+
+	firstDefault := len(fn.Parameters) - len(fn.Defaults)
+	for paramIdx := len(args); paramIdx < len(fn.Parameters); paramIdx++ {
+		value := Eval(fn.Defaults[paramIdx-firstDefault], env)
+		if isAbrupt(value) {
+			return nil, value
+		}
+		env.Set(fn.Parameters[paramIdx].Value, value)
 	}
 
-	return env
+	return env, nil
+}
+
+// arity describes the numbers of arguments fn accepts, for errors.
+func arity(fn *object.Function) string {
+	required := len(fn.Parameters) - len(fn.Defaults)
+	switch {
+	case fn.Rest != nil:
+		return fmt.Sprintf("at least %d", required)
+	case len(fn.Defaults) > 0:
+		return fmt.Sprintf("%d to %d", required, len(fn.Parameters))
+	default:
+		return fmt.Sprintf("%d", required)
+	}
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -1,6 +1,7 @@
 package evaluator
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/natac13/monkey-compiler/internal/lexer"
@@ -28,6 +29,8 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"10 + 9 % 4 * 2", 12},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -35,6 +38,25 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"2.5", 2.5},
+		{"-2.5", -2.5},
+		{"1.5 + 2.25", 3.75},
+		{"1.5 - 2", -0.5},
+		{"2 * 0.25", 0.5},
+		{"7 / 2.0", 3.5},
+		{"(1 + 0.5) * 2", 3.0},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -50,6 +72,19 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 != 1", false},
 		{"1 == 2", false},
 		{"1 != 2", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 >= 4", false},
+		{"2.5 >= 2", true},
+		{"true && false", false},
+		{"1 && 2", true},
+		{"false || true", true},
+		{"false || false", false},
+		{"false && missing", false},
+		{"true || missing", true},
+		{"1.5 > 1", true},
+		{"1 < 0.5", false},
+		{"2 == 2.0", true},
 		{"true == true", true},
 		{"false == false", true},
 		{"true == false", false},
@@ -59,6 +94,9 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"\"a\" + \"b\" == \"ab\"", true},
+		{"\"a\" != \"a\"", false},
+		{"\"a\" == 1", false},
 	}
 
 	for _, tt := range tests {
@@ -98,6 +136,36 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 } else { 30 }", 30},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 }", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"match (2) { 1 => 10, 2 => 20, _ => 30 }", 20},
+		{"match (5) { 1 => 10, 2 => 20, _ => 30 }", 30},
+		{"match (5) { 1 => 10 }", nil},
+		{"match (\"b\") { \"a\" => 1, \"b\" => 2 }", 2},
+		{"match (1 + 1) { true => 1, \"2\" => 2, 2.0 => 3 }", 3},
+		{"match (-1) { -1 => 1, _ => 2 }", 1},
+		{"match (1) { 1 => { let x = 5; x * 2 } }", 10},
+		{"let n = 0; for (x in [1, 2, 3]) { match (x) { 2 => { continue; }, _ => { n += x } } }; n", 4},
+		{"let f = fn() { for (x in [1, 2, 3]) { match (x) { 2 => { return x * 100; } } } }; f()", 200},
 	}
 
 	for _, tt := range tests {
@@ -111,6 +179,189 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
+func TestStructuralPatterns(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"match ([1, 2]) { [a, b] => a + b }", 3},
+		{"match ([1, 2, 3]) { [a, b] => 0, [a, b, c] => c }", 3},
+		{"match ([1, 2, 3]) { [first, ...rest] => len(rest) }", 2},
+		{"match ([1]) { [first, ...rest] => len(rest) }", 0},
+		{"match ([1]) { [a, b, ...rest] => 1 }", nil},
+		{"match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }", 6},
+		{"match ([1, [2]]) { [a, [b, c]] => 1, [a, [b]] => b }", 2},
+		{"match (\"ab\") { [a, b] => 1, _ => 2 }", 2},
+		{"match ({\"type\": \"user\", \"id\": 7}) { {\"type\": \"admin\"} => 1, {\"type\": \"user\", \"id\": n} => n }", 7},
+		{"match ({\"a\": 1}) { {\"b\": _} => 1, {} => 2 }", 2},
+		{"match ({\"a\": {\"b\": 1}}) { {\"a\": {\"b\": b}} => b + 10 }", 11},
+		{"match ([1]) { {} => 1, _ => 2 }", 2},
+		{"match (5) { x if x > 10 => 1, x if x > 0 => 2, _ => 3 }", 2},
+		{"match ([3, 4]) { [a, b] if a > b => a, [a, b] => b }", 4},
+		{"let f = fn(p) { match (p) { [a, b] => fn() { a + b } } }; f([1, 2])()", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestWhileStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (false) { 1 }; i", 0},
+		{"let i = 0; let s = 0; while (i < 10) { let i = i + 1; let s = s + i; } s", 55},
+		{"let i = 0; while (true) { let i = i + 1; if (i == 5) { break; } } i", 5},
+		{"let i = 0; let s = 0; while (i < 10) { let i = i + 1; if (i % 2 == 0) { continue; } let s = s + i; } s", 25},
+		{"let f = fn() { let i = 0; while (true) { let i = i + 1; if (i == 3) { return i * 10; } } }; f()", 30},
+		{"let i = 0; let n = 0; while (i < 3) { let i = i + 1; let j = 0; while (true) { let j = j + 1; if (j > 4) { break; } let n = n + 1; } } n", 12},
+		{"while (false) { 1 }", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let s = 0; for (x in [1, 2, 3]) { let s = s + x; }; s", 6},
+		{"let s = 0; for (i, x in [10, 20, 30]) { let s = s + i * x; }; s", 80},
+		{"let s = \"\"; for (k in {\"b\": 1, \"a\": 2, \"c\": 3}) { let s = s + k; }; s", "abc"},
+		{"let s = \"\"; for (k, v in {2: \"b\", 1: \"a\", true: \"t\"}) { let s = s + v; }; s", "tab"},
+		{"let s = \"\"; for (ch in \"héllo\") { let s = ch + s; }; s", "olléh"},
+		{"let s = 0; for (x in [1, 2, 3, 4, 5]) { if (x > 3) { break; } if (x == 2) { continue; } let s = s + x; }; s", 4},
+		{"let f = fn(xs) { for (x in xs) { if (x > 1) { return x * 10; } } }; f([1, 2, 3])", 20},
+		// every iteration assigns the same binding
+		{"let fs = []; for (x in [1, 2, 3]) { let fs = push(fs, fn() { x }) }; fs[0]()", 3},
+		{"let f = fn() { let fs = []; for (x in [1, 2, 3]) { fs = push(fs, fn() { x }) }; fs[0]() }; f()", 3},
+		{"let fs = []; for (x in [1, 2, 3]) { let fs = push(fs, fn(x) { fn() { x } }(x)) }; fs[0]()", 1},
+		{"for (x in [1, 2, 3]) { }; x", 3},
+		{"for (x in []) { x }", nil},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("String has wrong value. want=%q, got=%q", expected, result.Value)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("wrong error message. want=%q, got=%q", expected, result.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error. got=%T (%+v)", evaluated, evaluated)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestLoopExitsInExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let i = 0; while (i < 5000) { let i = i + 1; [1, if (true) { continue; }] }; i", 5000},
+		{"let i = 0; let n = 0; while (i < 5000) { i += 1; n = n + 1 + match (i) { _ => { continue; } } }; n", 0},
+		{"let g = fn(a, b, c) { a }; let i = 0; while (true) { let i = i + 1; g(1, 2, if (i == 3) { break; }) }; i", 3},
+		{"let s = 0; for (x in [1, 2, 3]) { let s = s + x * if (x == 2) { continue; } else { 1 } }; s", 4},
+		{"let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { let n = n + [x, if (y == 2) { break; } else { y }][1] } }; n", 2},
+		{"let f = fn() { 1 + if (true) { return 5; } }; f()", 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestRedefinitions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// redefining a name reuses its binding, so earlier closures see the new value
+		{"let x = 1; let x = x + 1; x", 2},
+		{"let x = 1; let f = fn() { x }; let x = 2; f()", 2},
+		{"let g = fn() { let x = 1; let x = x * 10; x }; g()", 10},
+		{"let g = fn(a) { let a = a + 1; a }; g(1)", 2},
+		{"let g = fn() { let x = 1; let f = fn() { x }; let x = 2; f() }; g()", 2},
+		{"let g = fn() { let x = 1; let f = fn() { x }; let x = 2; let h = fn() { x }; f() + h() }; g()", 4},
+		{"let g = fn(x) { let f = fn() { x }; let x = x + 1; f() }; g(1)", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; let y = x = 5; x + y", 10},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", 6},
+		{"let i = 0; let n = 0; while (i < 5) { i += 1; n = n + i; } n", 15},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", 3},
+		{"let a = [1, 2, 3]; a[1] = 20; a[2] += 10; a[1] + a[2]", 33},
+		{"let h = {}; h[\"a\"] = 1; h[\"a\"] += 1; h[\"a\"]", 2},
+		// a function can assign to the variable holding it
+		{"let f = fn() { f = 1 }; f()", 1},
+		{"let f = fn() { f = 1 }; f(); f", 1},
+		{"let g = fn() { let f = fn() { f = 1 }; f(); f }; g()", 1},
+		{"let f = fn(n) { if (n == 0) { f = 10; 0 } else { f(n - 1) } }; f(3); f", 10},
+		{"y = 1", "identifier not found: y"},
+		{"len = 1", "cannot assign to builtin len"},
+		{"let a = [1]; a[1] = 2", "index out of range: 1 with length 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -188,10 +439,22 @@ if (10 > 1) {
 			"foobar",
 			"identifier not found: foobar",
 		},
+		{"1 / 0", "division by zero"},
+		{"let f = fn(x) { 10 % x }; f(0);", "division by zero"},
 		{
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{"fn(a, b = 1) { a + b; }();", "wrong number of arguments: want=1 to 2, got=0"},
+		{"fn(a, b = 1) { a + b; }(1, 2, 3);", "wrong number of arguments: want=1 to 2, got=3"},
+		{"fn(a, ...rest) { a; }();", "wrong number of arguments: want=at least 1, got=0"},
+		{"fn(a, b = a + true) { b }(1);", "type mismatch: INTEGER + BOOLEAN"},
+		{"let [a] = 1;", "cannot destructure INTEGER as ARRAY"},
+		{`let {"a": a} = [1];`, "cannot destructure ARRAY as HASH"},
+		{"let! [a, b] = [1];", "index out of range: 1 with length 1"},
+		{"let! [a, _] = [1];", "index out of range: 1 with length 1"},
+		{`let! {"a": a, "b": b} = {"a": 1};`, "missing key b"},
+		{"let! [a] = if (false) { 1 };", "cannot destructure NULL as ARRAY"},
 	}
 
 	for _, tt := range tests {
@@ -209,6 +472,64 @@ if (10 > 1) {
 	}
 }
 
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [a, b] = [1]; b", nil},
+		{"let [a, ...rest] = [1, 2, 3]; len(rest)", 2},
+		{"let [a, b, ...rest] = [1]; len(rest)", 0},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", 6},
+		{"let [a, [b, c]] = [1]; c", nil},
+		{"let {\"x\": x, \"y\": y} = {\"x\": 1, \"y\": 2}; x - y", -1},
+		{"let {\"x\": x, \"z\": z} = {\"x\": 1}; z", nil},
+		{"let! [a, b] = [1, 2, 3]; a + b", 3},
+		{"let a = 1; let b = 2; let [a, b] = [b, a]; a * 10 + b", 21},
+		{"let f = fn(point) { let {\"x\": x, \"y\": y} = point; fn() { x + y } }; f({\"x\": 1, \"y\": 2})()", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(a, b = 10) { a + b }; f(1)", 11},
+		{"let f = fn(a, b = 10) { a + b }; f(1, 2)", 3},
+		{"let f = fn(a = 1, b = a * 2) { a * 10 + b }; f()", 12},
+		{"let f = fn(a = 1, b = a * 2) { a * 10 + b }; f(5)", 60},
+		{"let f = fn(a, b = if (false) { 1 }) { b }; f(1)", nil},
+		{"let f = fn(first, ...rest) { len(rest) }; f(1, 2, 3)", 2},
+		{"let f = fn(first, ...rest) { len(rest) }; f(1)", 0},
+		{"let f = fn(...args) { len(args) }; f() + f(1, 2, 3)", 3},
+		{"let f = fn(a, b = 2, ...rest) { a + b + len(rest) }; f(1, 5, 9, 9)", 8},
+		{"let count = fn(n = 0) { fn() { n += 1 } }; let c = count(10); c(); c()", 12},
+		{"let fact = fn(n, acc = 1) { if (n == 0) { return acc; } fact(n - 1, acc * n) }; fact(5)", 120},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -353,6 +674,12 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`rest([])`, nil},
 		{`push([], 1)`, []int{1}},
 		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`len(map([1, 2, 3], fn(x) { x * 2 }))`, 3},
+		{`last(map([1, 2, 3], fn(x) { x * 2 }))`, 6},
+		{`first(filter([1, 2, 3, 4], fn(x) { x > 2 }))`, 3},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, 10},
+		{`map([1], fn(x) { 1 / 0 })`, "division by zero"},
+		{`map([1], fn(a, b) { a })`, "wrong number of arguments: want=2, got=1"},
 	}
 
 	for _, tt := range tests {
@@ -557,6 +884,42 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestCallbackErrorIgnoredByBuiltin(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("try", &object.Builtin{Fn: func(host object.Host, args ...object.Object) object.Object {
+		if _, err := host.Call(args[0]); err != nil {
+			return &object.String{Value: "caught"}
+		}
+		return nil
+	}})
+
+	// a failed callback stops the program, even if the builtin carries on
+	program := parser.New(lexer.New(`try(fn() { 1 / 0 })`)).ParseProgram()
+	evaluated := Eval(program, env)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "division by zero" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestBuiltinIO(t *testing.T) {
+	input := `let say = fn(x) { puts(x) }; say("hello"); map([1, 2], fn(x) { puts(x * 10) });`
+
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	env.SetIO(&object.IO{Stdout: &out})
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	Eval(program, env)
+
+	if out.String() != "hello\n10\n20\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -579,6 +942,19 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%f, want=%f", result.Value, expected)
+		return false
+	}
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
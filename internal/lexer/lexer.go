@@ -1,6 +1,11 @@
 package lexer
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/natac13/monkey-compiler/internal/token"
 )
 
@@ -9,12 +14,14 @@ type Lexer struct {
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
 	ch           byte // current char under examination
+	line         int  // line of the current char, starting at 1
+	column       int  // column of the current char, starting at 1
 }
 
 // New creates a new instance of the Lexer struct with the given input string.
 // It initializes the lexer and returns a pointer to the newly created Lexer.
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
@@ -22,19 +29,24 @@ func New(input string) *Lexer {
 // NextToken scans the input and returns the next token.
 // It examines the current character and determines the appropriate token type.
 // If the current character is a letter, it reads an identifier.
-// If the current character is a digit, it reads a number.
+// If the current character is a digit, it reads a number, either an integer or a float.
 // If the current character is a special character, it creates a token based on the character.
 // If the current character is 0, it creates an EOF token.
 // If the current character is none of the above, it creates an ILLEGAL token.
 // The function then advances to the next character and returns the token.
+// Every token carries the source position of its first character.
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
 
+	pos := l.currentPosition()
+
 	switch l.ch {
 	case '=':
-		if l.peekChar() == '=' {
+		if l.peekChar() == '>' {
+			tok = l.readTwoCharToken(token.ARROW)
+		} else if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			literal := string(ch) + string(l.ch)
@@ -46,9 +58,17 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.PLUS_ASSIGN)
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.MINUS_ASSIGN)
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -62,13 +82,52 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		switch l.peekChar() {
+		case '/':
+			l.skipLineComment()
+			return l.NextToken()
+		case '*':
+			if !l.skipBlockComment() {
+				return token.Token{Type: token.ILLEGAL, Literal: "unterminated block comment", Pos: pos}
+			}
+			return l.NextToken()
+		case '=':
+			tok = l.readTwoCharToken(token.SLASH_ASSIGN)
+		default:
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.ASTERISK_ASSIGN)
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.LT_EQ)
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.GT_EQ)
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			tok = l.readTwoCharToken(token.AND)
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = l.readTwoCharToken(token.OR)
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case '(':
@@ -78,10 +137,22 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		str, err := l.readString()
+		if err != nil {
+			tok = token.Token{Type: token.ILLEGAL, Literal: err.Error()}
+		} else {
+			tok = token.Token{Type: token.STRING, Literal: str}
+		}
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.readPosition+1 < len(l.input) && l.input[l.readPosition+1] == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
@@ -97,16 +168,18 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 
+	tok.Pos = pos
 	l.readChar()
 	return tok
 }
@@ -114,6 +187,12 @@ func (l *Lexer) NextToken() token.Token {
 // readChar reads the next character from the input and updates the lexer's position.
 // If there are no more characters in the input, it sets the current character to 0.
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -124,6 +203,18 @@ func (l *Lexer) readChar() {
 	l.readPosition++
 }
 
+// readTwoCharToken consumes the current and the next char as a single token, e.g. <=.
+func (l *Lexer) readTwoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
+}
+
+// currentPosition returns the source position of the current char.
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{Line: l.line, Column: l.column, Offset: l.position}
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 	for isLetter(l.ch) {
@@ -138,12 +229,55 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func (l *Lexer) readNumber() string {
+// skipLineComment skips a `//` comment up to, but not including, the end of the line.
+func (l *Lexer) skipLineComment() {
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
+// skipBlockComment skips a `/* ... */` comment. Block comments nest, so every
+// `/*` inside the comment needs its own `*/`.
+// It returns false if the input ends before the comment is closed.
+func (l *Lexer) skipBlockComment() bool {
+	depth := 0
+	for {
+		switch {
+		case l.ch == 0:
+			return false
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+			if depth == 0 {
+				l.readChar()
+				return true
+			}
+		}
+		l.readChar()
+	}
+}
+
+// readNumber reads an integer, or a float if the digits are followed by a '.' and more digits.
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
+
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+
+	return l.input[position:l.position], tokenType
 }
 
 func (l *Lexer) peekChar() byte {
@@ -153,16 +287,81 @@ func (l *Lexer) peekChar() byte {
 	return l.input[l.readPosition]
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
+// readString reads a string literal and resolves its escape sequences.
+// It stops on the closing quote. If the literal contains an invalid escape sequence
+// the rest of the literal is still consumed, so lexing can continue after it.
+func (l *Lexer) readString() (string, error) {
+	var out strings.Builder
+	var err error
+
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		switch l.ch {
+		case '"':
+			return out.String(), err
+		case 0:
+			return "", fmt.Errorf("unterminated string")
+		case '\\':
+			l.readChar()
+			if escErr := l.readEscape(&out); escErr != nil && err == nil {
+				err = escErr
+			}
+		default:
+			out.WriteByte(l.ch)
 		}
 	}
-	return l.input[position:l.position]
+}
 
+// readEscape writes the character for the escape sequence starting at the current char,
+// which is the one right after the backslash.
+func (l *Lexer) readEscape(out *strings.Builder) error {
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '\\', '"':
+		out.WriteByte(l.ch)
+	case 'u':
+		return l.readUnicodeEscape(out)
+	case 0:
+		// leave the EOF for readString to report
+	default:
+		return fmt.Errorf("invalid escape sequence \\%c", l.ch)
+	}
+	return nil
+}
+
+// readUnicodeEscape reads the `{XXXX}` part of a `\u{XXXX}` escape sequence
+// and writes the UTF-8 encoding of the code point.
+// It only ever peeks at the closing quote, so a malformed escape never swallows it.
+func (l *Lexer) readUnicodeEscape(out *strings.Builder) error {
+	if l.peekChar() != '{' {
+		return fmt.Errorf("invalid unicode escape: expected \\u{...}")
+	}
+	l.readChar()
+
+	start := l.readPosition
+	for isHexDigit(l.peekChar()) {
+		l.readChar()
+	}
+	digits := l.input[start:l.readPosition]
+
+	if l.peekChar() != '}' || len(digits) == 0 || len(digits) > 6 {
+		return fmt.Errorf("invalid unicode escape: \\u{%s", digits)
+	}
+	l.readChar()
+
+	value, _ := strconv.ParseUint(digits, 16, 32)
+	r := rune(value)
+	if !utf8.ValidRune(r) {
+		return fmt.Errorf("invalid unicode code point: \\u{%s}", digits)
+	}
+
+	out.WriteRune(r)
+	return nil
 }
 
 // helper functions
@@ -181,3 +380,7 @@ func isLetter(ch byte) bool {
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
+
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
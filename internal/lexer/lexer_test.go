@@ -15,7 +15,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -31,6 +31,10 @@ if (5 < 10) {
 "foo bar"
 [1, 2];
 {"foo": "bar"}
+while (x) { break; continue; }
+for (k, v in h) {}
+match (x) { _ => 1 }
+[a, ...b]
 `
 
 	tests := []struct {
@@ -123,6 +127,41 @@ if (5 < 10) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.WHILE, "while"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.BREAK, "break"},
+		{token.SEMICOLON, ";"},
+		{token.CONTINUE, "continue"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENT, "k"},
+		{token.COMMA, ","},
+		{token.IDENT, "v"},
+		{token.IN, "in"},
+		{token.IDENT, "h"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "b"},
+		{token.RBRACKET, "]"},
 		{token.EOF, ""},
 	}
 
@@ -187,3 +226,270 @@ func TestReadIdentifier(t *testing.T) {
 		t.Fatalf("expected=%q, got=%q", expected, got)
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let five = 5;
+let add = fn(x) {
+	x + "y";
+};`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+		expectedOffset int
+	}{
+		{token.LET, 1, 1, 0},
+		{token.IDENT, 1, 5, 4},
+		{token.ASSIGN, 1, 10, 9},
+		{token.INT, 1, 12, 11},
+		{token.SEMICOLON, 1, 13, 12},
+		{token.LET, 2, 1, 14},
+		{token.IDENT, 2, 5, 18},
+		{token.ASSIGN, 2, 9, 22},
+		{token.FUNCTION, 2, 11, 24},
+		{token.LPAREN, 2, 13, 26},
+		{token.IDENT, 2, 14, 27},
+		{token.RPAREN, 2, 15, 28},
+		{token.LBRACE, 2, 17, 30},
+		{token.IDENT, 3, 2, 33},
+		{token.PLUS, 3, 4, 35},
+		{token.STRING, 3, 6, 37},
+		{token.SEMICOLON, 3, 9, 40},
+		{token.RBRACE, 4, 1, 42},
+		{token.SEMICOLON, 4, 2, 43},
+		{token.EOF, 4, 3, 44},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%s", i, tt.expectedLine, tt.expectedColumn, tok.Pos)
+		}
+
+		if tok.Pos.Offset != tt.expectedOffset {
+			t.Fatalf("tests[%d] - offset wrong. expected=%d, got=%d", i, tt.expectedOffset, tok.Pos.Offset)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// a line comment
+let x = 10; // trailing comment
+/* a block
+   comment */ x / 2;
+/* outer /* nested */ still a comment */
+x;
+/* never closed`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "10"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SEMICOLON, ";"},
+		{token.ILLEGAL, "unterminated block comment"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestUnterminatedBlockCommentPosition(t *testing.T) {
+	l := New("x;\n  /* /* */")
+
+	l.NextToken()
+	l.NextToken()
+	tok := l.NextToken()
+
+	if tok.Type != token.ILLEGAL {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.ILLEGAL, tok.Type)
+	}
+
+	if tok.Pos.String() != "2:3" {
+		t.Fatalf("position wrong. expected=2:3, got=%s", tok.Pos)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"plain"`, token.STRING, "plain"},
+		{`"line\nbreak"`, token.STRING, "line\nbreak"},
+		{`"tab\tstop\r"`, token.STRING, "tab\tstop\r"},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"say \"hi\""`, token.STRING, `say "hi"`},
+		{`"\u{41}\u{e9}\u{1F600}"`, token.STRING, "Aé😀"},
+		{`"bad \q escape"`, token.ILLEGAL, `invalid escape sequence \q`},
+		{`"\u41"`, token.ILLEGAL, `invalid unicode escape: expected \u{...}`},
+		{`"\u{41"`, token.ILLEGAL, `invalid unicode escape: \u{41`},
+		{`"\u{}"`, token.ILLEGAL, `invalid unicode escape: \u{`},
+		{`"\u{110000}"`, token.ILLEGAL, `invalid unicode code point: \u{110000}`},
+		{`"never closed`, token.ILLEGAL, "unterminated string"},
+		{`"escaped quote at end\"`, token.ILLEGAL, "unterminated string"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF after string, got=%q", i, next.Type)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := `5 3.14 0.5 10.0 7.x 1.2.3`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "0.5"},
+		{token.FLOAT, "10.0"},
+		{token.INT, "7"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.FLOAT, "1.2"},
+		{token.ILLEGAL, "."},
+		{token.INT, "3"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComparisonAndLogicalOperators(t *testing.T) {
+	input := `a <= b >= c < d > e % f && g || h & |`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.LT, "<"},
+		{token.IDENT, "d"},
+		{token.GT, ">"},
+		{token.IDENT, "e"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "f"},
+		{token.AND, "&&"},
+		{token.IDENT, "g"},
+		{token.OR, "||"},
+		{token.IDENT, "h"},
+		{token.ILLEGAL, "&"},
+		{token.ILLEGAL, "|"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestAssignmentOperators(t *testing.T) {
+	input := `a = b += c -= d *= e /= f + -1`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "b"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.IDENT, "c"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.IDENT, "d"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.IDENT, "e"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.IDENT, "f"},
+		{token.PLUS, "+"},
+		{token.MINUS, "-"},
+		{token.INT, "1"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
@@ -2,13 +2,15 @@ package object
 
 import "fmt"
 
+// Builtins are the standard builtins. Compilers and VMs use them through a Registry,
+// see NewRegistry, so this slice is never modified.
 var Builtins = []struct {
 	Name    string
 	Builtin *Builtin
 }{
 	{
 		"len",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(host Host, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
@@ -25,16 +27,16 @@ var Builtins = []struct {
 	},
 	{
 		"puts",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(host Host, args ...Object) Object {
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				fmt.Fprintln(host.IO().Stdout, arg.Inspect())
 			}
 			return nil
 		}},
 	},
 	{
 		"first",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(host Host, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
@@ -50,7 +52,7 @@ var Builtins = []struct {
 	},
 	{
 		"last",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(host Host, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
@@ -67,7 +69,7 @@ var Builtins = []struct {
 	},
 	{
 		"rest",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(host Host, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
@@ -77,6 +79,9 @@ var Builtins = []struct {
 			arr := args[0].(*Array)
 			length := len(arr.Elements)
 			if length > 0 {
+				if err := host.Allocate(ArraySize(length - 1)); err != nil {
+					return newError("%s", err)
+				}
 				newElements := make([]Object, length-1)
 				copy(newElements, arr.Elements[1:length])
 				return &Array{Elements: newElements}
@@ -86,7 +91,7 @@ var Builtins = []struct {
 	},
 	{
 		"push",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(host Host, args ...Object) Object {
 			if len(args) != 2 {
 				return newError("wrong number of arguments. got=%d, want=2", len(args))
 			}
@@ -95,12 +100,99 @@ var Builtins = []struct {
 			}
 			arr := args[0].(*Array)
 			length := len(arr.Elements)
+			if err := host.Allocate(ArraySize(length + 1)); err != nil {
+				return newError("%s", err)
+			}
 			newElements := make([]Object, length+1)
 			copy(newElements, arr.Elements)
 			newElements[length] = args[1]
 			return &Array{Elements: newElements}
 		}},
 	},
+	{
+		"map",
+		&Builtin{Fn: func(host Host, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `map` must be ARRAY, got %s", args[0].Type())
+			}
+			arr := args[0].(*Array)
+			if err := host.Allocate(ArraySize(len(arr.Elements))); err != nil {
+				return newError("%s", err)
+			}
+			newElements := make([]Object, len(arr.Elements))
+			for i, el := range arr.Elements {
+				result, err := host.Call(args[1], el)
+				if err != nil {
+					return newError("%s", err)
+				}
+				newElements[i] = result
+			}
+			return &Array{Elements: newElements}
+		}},
+	},
+	{
+		"filter",
+		&Builtin{Fn: func(host Host, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `filter` must be ARRAY, got %s", args[0].Type())
+			}
+			arr := args[0].(*Array)
+			// filter can't know the size of its result upfront, so it accounts for the largest one
+			if err := host.Allocate(ArraySize(len(arr.Elements))); err != nil {
+				return newError("%s", err)
+			}
+			newElements := []Object{}
+			for _, el := range arr.Elements {
+				result, err := host.Call(args[1], el)
+				if err != nil {
+					return newError("%s", err)
+				}
+				if isTruthy(result) {
+					newElements = append(newElements, el)
+				}
+			}
+			return &Array{Elements: newElements}
+		}},
+	},
+	{
+		"reduce",
+		&Builtin{Fn: func(host Host, args ...Object) Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `reduce` must be ARRAY, got %s", args[0].Type())
+			}
+			arr := args[0].(*Array)
+			accumulator := args[1]
+			for _, el := range arr.Elements {
+				result, err := host.Call(args[2], accumulator, el)
+				if err != nil {
+					return newError("%s", err)
+				}
+				accumulator = result
+			}
+			return accumulator
+		}},
+	},
+}
+
+// isTruthy follows the truthiness rules of the VM and evaluator: only false and null are falsy.
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
 }
 
 func newError(format string, a ...interface{}) *Error {
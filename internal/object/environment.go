@@ -3,6 +3,8 @@ package object
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+	// io is used by builtins called in this environment, nil to use the outer one's
+	io *IO
 }
 
 func NewEnvironment() *Environment {
@@ -28,3 +30,31 @@ func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// Assign sets name to val in the innermost environment defining it.
+// It returns false if name isn't defined.
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = val
+			return true
+		}
+	}
+	return false
+}
+
+// SetIO sets the streams used by builtins called in this environment and the ones it encloses.
+func (e *Environment) SetIO(io *IO) {
+	e.io = io
+}
+
+// IO returns the streams for builtins, falling back to the outer environment
+// and finally to the standard streams.
+func (e *Environment) IO() *IO {
+	for env := e; env != nil; env = env.outer {
+		if env.io != nil {
+			return env.io
+		}
+	}
+	return StandardIO()
+}
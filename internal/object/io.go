@@ -0,0 +1,19 @@
+package object
+
+import (
+	"io"
+	"os"
+)
+
+// IO holds the streams builtins read from and write to, so a host can
+// capture or redirect a program's output instead of using the process's.
+type IO struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// StandardIO returns an IO using the process's standard streams.
+func StandardIO() *IO {
+	return &IO{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+}
@@ -0,0 +1,150 @@
+package object
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// Iterator steps through the elements of an array, hash or string for a for-in loop.
+type Iterator struct {
+	next func() (key, value Object, ok bool)
+	// keyed is set for hashes, whose one-variable loops bind the key rather than the value
+	keyed bool
+	// makesValues is set for strings, whose characters are new strings made as the loop goes
+	makesValues bool
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "iterator" }
+
+// NewIterator returns an iterator over obj, or false if obj can't be iterated over.
+// Arrays yield each index and element, strings the index and text of each character,
+// and hashes each key and value in the order of SortedPairs.
+func NewIterator(obj Object) (*Iterator, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		i := 0
+		next := func() (Object, Object, bool) {
+			// the array is read as the loop goes, so changes made by the body are seen
+			if i >= len(obj.Elements) {
+				return nil, nil, false
+			}
+			key, value := &Integer{Value: int64(i)}, obj.Elements[i]
+			i++
+			return key, value, true
+		}
+		return &Iterator{next: next}, true
+
+	case *String:
+		offset, i := 0, 0
+		next := func() (Object, Object, bool) {
+			if offset >= len(obj.Value) {
+				return nil, nil, false
+			}
+			_, size := utf8.DecodeRuneInString(obj.Value[offset:])
+			key, value := &Integer{Value: int64(i)}, &String{Value: obj.Value[offset : offset+size]}
+			offset += size
+			i++
+			return key, value, true
+		}
+		return &Iterator{next: next, makesValues: true}, true
+
+	case *Hash:
+		pairs := obj.SortedPairs()
+		i := 0
+		next := func() (Object, Object, bool) {
+			if i >= len(pairs) {
+				return nil, nil, false
+			}
+			pair := pairs[i]
+			i++
+			return pair.Key, pair.Value, true
+		}
+		return &Iterator{next: next, keyed: true}, true
+
+	default:
+		return nil, false
+	}
+}
+
+// Next advances the iterator and returns the value a one-variable loop binds:
+// the key for hashes and the element otherwise. ok is false once the iterator is exhausted.
+func (it *Iterator) Next() (value Object, ok bool) {
+	key, value, ok := it.next()
+	if it.keyed {
+		return key, ok
+	}
+	return value, ok
+}
+
+// MakesValues reports whether the elements the iterator yields are new objects rather than
+// ones the iterable holds, so hosts limiting memory must account for them.
+func (it *Iterator) MakesValues() bool {
+	return it.makesValues
+}
+
+// NextPair advances the iterator and returns the index or key and the element or value
+// a two-variable loop binds. ok is false once the iterator is exhausted.
+func (it *Iterator) NextPair() (key, value Object, ok bool) {
+	return it.next()
+}
+
+// SortedPairs returns the pairs of the hash ordered by key, so iterating over a hash is
+// deterministic. Booleans come first, then numbers in numeric order, then strings in
+// byte order.
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return keyLess(pairs[i].Key, pairs[j].Key)
+	})
+
+	return pairs
+}
+
+// keyLess orders hash keys for SortedPairs.
+func keyLess(a, b Object) bool {
+	rankA, rankB := keyRank(a), keyRank(b)
+	if rankA != rankB {
+		return rankA < rankB
+	}
+
+	switch a := a.(type) {
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	}
+
+	x, y := numberValue(a), numberValue(b)
+	if x != y {
+		return x < y
+	}
+	// an integer sorts before a float of the same value
+	return a.Type() == INTEGER_OBJ && b.Type() == FLOAT_OBJ
+}
+
+func keyRank(key Object) int {
+	switch key.(type) {
+	case *Boolean:
+		return 0
+	case *Integer, *Float:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func numberValue(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value)
+	case *Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
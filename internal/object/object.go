@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/natac13/monkey-compiler/internal/ast"
@@ -14,9 +16,12 @@ type ObjectType string
 
 const (
 	INTEGER_OBJ           ObjectType = "INTEGER"
+	FLOAT_OBJ             ObjectType = "FLOAT"
 	BOOLEAN_OBJ           ObjectType = "BOOLEAN"
 	NULL_OBJ              ObjectType = "NULL"
 	RETURN_VALUE_OBJ      ObjectType = "RETURN_VALUE"
+	BREAK_OBJ             ObjectType = "BREAK"
+	CONTINUE_OBJ          ObjectType = "CONTINUE"
 	ERROR_OBJ             ObjectType = "ERROR"
 	FUNCTION_OBJ          ObjectType = "FUNCTION"
 	STRING_OBJ            ObjectType = "STRING"
@@ -25,6 +30,8 @@ const (
 	HASH_OBJ              ObjectType = "HASH"
 	COMPILED_FUNCTION_OBJ ObjectType = "COMPILED_FUNCTION"
 	CLOSURE_OBJ           ObjectType = "CLOSURE"
+	ITERATOR_OBJ          ObjectType = "ITERATOR"
+	CELL_OBJ              ObjectType = "CELL"
 )
 
 type Object interface {
@@ -39,6 +46,20 @@ type Integer struct {
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	// keep a decimal point on whole numbers so 2.0 doesn't print like the integer 2
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -58,6 +79,18 @@ type ReturnValue struct {
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 
+// Break is the signal a break statement sends to its enclosing loop in the evaluator.
+type Break struct{}
+
+func (b *Break) Inspect() string  { return "break" }
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+
+// Continue is the signal a continue statement sends to its enclosing loop in the evaluator.
+type Continue struct{}
+
+func (c *Continue) Inspect() string  { return "continue" }
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+
 type Error struct {
 	Message string
 }
@@ -67,22 +100,21 @@ func (e *Error) Type() ObjectType { return ERROR_OBJ }
 
 type Function struct {
 	Parameters []*ast.Identifier
-	Body       *ast.BlockStatement
-	Env        *Environment
+	// Defaults are the default values of the last len(Defaults) parameters
+	Defaults []ast.Expression
+	// Rest is the parameter collecting the extra arguments, nil if there is none
+	Rest *ast.Identifier
+	Body *ast.BlockStatement
+	Env  *Environment
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
-	}
-
 	out.WriteString("fn")
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ast.ParameterList(f.Parameters, f.Defaults, f.Rest))
 	out.WriteString(") {\n")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n}")
@@ -97,7 +129,21 @@ type String struct {
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 
-type BuiltinFunction func(args ...Object) Object
+// Host is the engine a builtin is running in. It lets builtins call back into Monkey code.
+type Host interface {
+	// Call calls fn, a Monkey function or builtin, with args and returns its result.
+	// The error is non-nil if executing fn failed. The failure is always fatal: the program
+	// stops with it whatever the builtin returns, so the builtin can't recover from it and
+	// should return right away.
+	Call(fn Object, args ...Object) (Object, error)
+	// IO returns the streams the builtin should use for input and output.
+	IO() *IO
+	// Allocate accounts for size bytes the builtin is about to allocate for a string, array or hash.
+	// The error is non-nil if that exceeds the host's memory limit, which is fatal like a failed Call.
+	Allocate(size int64) error
+}
+
+type BuiltinFunction func(host Host, args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltinFunction
@@ -146,6 +192,10 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+func (f *Float) HashKey() HashKey {
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -183,9 +233,21 @@ type Hashable interface {
 }
 
 type CompiledFunction struct {
-	Instructions  code.Instructions
-	NumLocals     int
+	Instructions code.Instructions
+	NumLocals    int
+	// NumParameters is the number of parameters before the rest parameter, including the
+	// ones with a default value
 	NumParameters int
+	// NumDefaults is the number of parameters, at the end of the NumParameters, that have a
+	// default value and may be left out of a call
+	NumDefaults int
+	// Variadic is set if the function has a rest parameter, the local after the other
+	// parameters, which holds an array of the arguments beyond NumParameters
+	Variadic bool
+	// Name is the name the function was bound to with let, empty for anonymous functions
+	Name string
+	// SourceMap maps Instructions offsets back to source positions for runtime errors
+	SourceMap code.SourceMap
 }
 
 func (cn *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -202,3 +264,14 @@ func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
 func (c *Closure) Inspect() string {
 	return fmt.Sprintf("Closure[%p]", c)
 }
+
+// Cell holds a variable that a function shares with its closures, so that an assignment
+// made by one of them is seen by all.
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string {
+	return fmt.Sprintf("Cell[%s]", c.Value.Inspect())
+}
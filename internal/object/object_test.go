@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -58,3 +61,130 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{2, "2.0"},
+		{-0.25, "-0.25"},
+		{1e21, "1e+21"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong inspect for %f. expected=%q, got=%q", tt.value, tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+
+	names := registry.Names()
+	if len(names) != len(Builtins) || names[0] != "len" {
+		t.Fatalf("registry should start with the standard builtins. got=%v", names)
+	}
+
+	hello := func(host Host, args ...Object) Object { return &String{Value: "hello"} }
+	index, err := registry.Register("hello", hello)
+	if err != nil {
+		t.Fatalf("register error: %s", err)
+	}
+	if index != len(Builtins) {
+		t.Errorf("wrong index. want=%d, got=%d", len(Builtins), index)
+	}
+	if _, ok := registry.Lookup("hello"); !ok {
+		t.Errorf("registered builtin not found")
+	}
+
+	// replacing a builtin keeps its index
+	index, err = registry.Register("len", hello)
+	if err != nil || index != 0 {
+		t.Errorf("wrong index replacing len. got=%d (%v)", index, err)
+	}
+	builtin, ok := registry.Get(0)
+	if !ok || builtin.Fn(nil).Inspect() != "hello" {
+		t.Errorf("len was not replaced")
+	}
+
+	// other registries are unaffected
+	if _, ok := NewRegistry().Lookup("hello"); ok {
+		t.Errorf("registering must not change other registries")
+	}
+	if builtin, _ := NewRegistry().Lookup("len"); builtin != GetBuiltinByName("len") {
+		t.Errorf("len was replaced in a new registry")
+	}
+
+	if _, ok := registry.Get(MaxBuiltins); ok {
+		t.Errorf("expected out of range index to be missing")
+	}
+	for i := len(registry.Names()); i < MaxBuiltins; i++ {
+		if _, err := registry.Register(fmt.Sprintf("fn%d", i), hello); err != nil {
+			t.Fatalf("register error: %s", err)
+		}
+	}
+	if _, err := registry.Register("overflow", hello); err == nil {
+		t.Errorf("expected an error registering more than %d builtins", MaxBuiltins)
+	}
+}
+
+func TestHashSortedPairs(t *testing.T) {
+	keys := []Object{
+		&String{Value: "b"},
+		&Integer{Value: 10},
+		&Float{Value: 2.5},
+		&String{Value: "a"},
+		&Boolean{Value: true},
+		&Integer{Value: 2},
+		&Boolean{Value: false},
+	}
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range keys {
+		hash.Pairs[key.(Hashable).HashKey()] = HashPair{Key: key, Value: key}
+	}
+
+	expected := []string{"false", "true", "2", "2.5", "10", "a", "b"}
+
+	pairs := hash.SortedPairs()
+	if len(pairs) != len(expected) {
+		t.Fatalf("wrong number of pairs. want=%d, got=%d", len(expected), len(pairs))
+	}
+	for i, pair := range pairs {
+		if pair.Key.Inspect() != expected[i] {
+			t.Errorf("pairs[%d] has wrong key. want=%s, got=%s", i, expected[i], pair.Key.Inspect())
+		}
+	}
+}
+
+func TestIterator(t *testing.T) {
+	if _, ok := NewIterator(&Integer{Value: 1}); ok {
+		t.Fatalf("expected integers not to be iterable")
+	}
+
+	iterator, ok := NewIterator(&String{Value: "añb"})
+	if !ok {
+		t.Fatalf("expected strings to be iterable")
+	}
+
+	expected := []string{"a", "ñ", "b"}
+	for i, want := range expected {
+		key, value, ok := iterator.NextPair()
+		if !ok {
+			t.Fatalf("iterator exhausted after %d characters", i)
+		}
+		if key.(*Integer).Value != int64(i) {
+			t.Errorf("wrong index. want=%d, got=%s", i, key.Inspect())
+		}
+		if value.(*String).Value != want {
+			t.Errorf("wrong character. want=%q, got=%q", want, value.Inspect())
+		}
+	}
+
+	if _, ok := iterator.Next(); ok {
+		t.Errorf("expected iterator to be exhausted")
+	}
+}
@@ -0,0 +1,71 @@
+package object
+
+import "fmt"
+
+// MaxBuiltins is the number of builtins a Registry can hold, as OpGetBuiltin
+// uses a 1 byte operand to index into it.
+const MaxBuiltins = 256
+
+// Registry holds the builtins available to a compiler and VM. The compiler resolves
+// builtin names to their index in the registry and the VM dispatches OpGetBuiltin by index,
+// so both must use the same registry. Each runtime gets its own registry, which lets
+// embedders expose different host functions without touching global state.
+type Registry struct {
+	names    []string
+	builtins []*Builtin
+	indexes  map[string]int
+}
+
+// NewRegistry returns a registry holding the standard builtins, in the order of Builtins.
+func NewRegistry() *Registry {
+	r := &Registry{indexes: make(map[string]int)}
+	for _, def := range Builtins {
+		r.add(def.Name, def.Builtin)
+	}
+	return r
+}
+
+// Register adds a builtin named name and returns its index. Registering an existing
+// name replaces that builtin in place, so code compiled against the registry stays valid.
+func (r *Registry) Register(name string, fn BuiltinFunction) (int, error) {
+	builtin := &Builtin{Fn: fn}
+
+	if index, ok := r.indexes[name]; ok {
+		r.builtins[index] = builtin
+		return index, nil
+	}
+
+	if len(r.builtins) >= MaxBuiltins {
+		return 0, fmt.Errorf("too many builtins, the maximum is %d", MaxBuiltins)
+	}
+	return r.add(name, builtin), nil
+}
+
+func (r *Registry) add(name string, builtin *Builtin) int {
+	r.names = append(r.names, name)
+	r.builtins = append(r.builtins, builtin)
+	r.indexes[name] = len(r.builtins) - 1
+	return len(r.builtins) - 1
+}
+
+// Get returns the builtin at index.
+func (r *Registry) Get(index int) (*Builtin, bool) {
+	if index < 0 || index >= len(r.builtins) {
+		return nil, false
+	}
+	return r.builtins[index], true
+}
+
+// Lookup returns the builtin named name.
+func (r *Registry) Lookup(name string) (*Builtin, bool) {
+	index, ok := r.indexes[name]
+	if !ok {
+		return nil, false
+	}
+	return r.builtins[index], true
+}
+
+// Names returns the names of the builtins, indexed like the builtins themselves.
+func (r *Registry) Names() []string {
+	return append([]string{}, r.names...)
+}
@@ -0,0 +1,42 @@
+package object
+
+// Approximate sizes in bytes of the values making up an object, used to account for
+// the memory a program allocates. They are estimates for a 64-bit platform, not exact.
+const (
+	objectHeaderSize = 16 // the object itself plus its interface value
+	sliceHeaderSize  = 24
+	elementSize      = 16 // an Object interface value in a slice
+	hashPairSize     = 72 // a map entry holding a HashKey and a HashPair
+)
+
+// StringSize returns the approximate size of a string object holding n bytes.
+func StringSize(n int) int64 {
+	return objectHeaderSize + int64(n)
+}
+
+// ArraySize returns the approximate size of an array object holding n elements,
+// not counting the elements themselves.
+func ArraySize(n int) int64 {
+	return objectHeaderSize + sliceHeaderSize + int64(n)*elementSize
+}
+
+// HashSize returns the approximate size of a hash object holding n pairs,
+// not counting the keys and values themselves.
+func HashSize(n int) int64 {
+	return objectHeaderSize + int64(n)*hashPairSize
+}
+
+// SizeOf returns the approximate size of strings, arrays and hashes, and 0 for
+// other objects, which aren't accounted for.
+func SizeOf(obj Object) int64 {
+	switch obj := obj.(type) {
+	case *String:
+		return StringSize(len(obj.Value))
+	case *Array:
+		return ArraySize(len(obj.Elements))
+	case *Hash:
+		return HashSize(len(obj.Pairs))
+	default:
+		return 0
+	}
+}
@@ -42,6 +42,43 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input          string
+		expected       string
+		expectedStrict bool
+	}{
+		{"let [a, b] = pair;", "let [a, b] = pair;", false},
+		{"let! [a, _, ...rest] = xs", "let! [a, _, ...rest] = xs;", true},
+		{`let {"x": x, "y": [y, z]} = point;`, "let {x: x, y: [y, z]} = point;", false},
+		{`let! {1: one} = h;`, "let! {1: one} = h;", true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.DestructuringLetStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.DestructuringLetStatement. got=%T",
+				program.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+		if stmt.Strict != tt.expectedStrict {
+			t.Errorf("stmt.Strict wrong. want=%t, got=%t", tt.expectedStrict, stmt.Strict)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -137,6 +174,37 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "3.25;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != 3.25 {
+		t.Errorf("literal.Value not %f. got=%f", 3.25, literal.Value)
+	}
+
+	if literal.TokenLiteral() != "3.25" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "3.25", literal.TokenLiteral())
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -334,6 +402,38 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a == b && c < d || !e",
+			"(((a == b) && (c < d)) || (!e))",
+		},
+		{
+			"a = b = c + 1",
+			"(a = (b = (c + 1)))",
+		},
+		{
+			"a += b * c || d",
+			"(a += ((b * c) || d))",
+		},
+		{
+			"a[i + 1] /= 2",
+			"((a[(i + 1)]) /= 2)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -495,6 +595,225 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < y) { if (x) { break; } continue; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("body is not 2 statements. got=%d\n", len(stmt.Body.Statements))
+	}
+
+	if _, ok := stmt.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Fatalf("Statements[1] is not ast.ContinueStatement. got=%T",
+			stmt.Body.Statements[1])
+	}
+
+	if stmt.String() != "while(x < y) ifx break;continue;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input             string
+		expectedVariables []string
+		expectedString    string
+	}{
+		{"for (x in xs) { x }", []string{"x"}, "for(x in xs) x"},
+		{"for (k, v in {1: 2}) { k + v; };", []string{"k", "v"}, "for(k, v in {1: 2}) (k + v)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+				1, len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T",
+				program.Statements[0])
+		}
+
+		if len(stmt.Variables) != len(tt.expectedVariables) {
+			t.Fatalf("wrong number of variables. want=%d, got=%d",
+				len(tt.expectedVariables), len(stmt.Variables))
+		}
+		for i, name := range tt.expectedVariables {
+			testLiteralExpression(t, stmt.Variables[i], name)
+		}
+
+		if stmt.String() != tt.expectedString {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expectedString, stmt.String())
+		}
+	}
+}
+
+func TestElseIfExpression(t *testing.T) {
+	input := `if (x < y) { x } else if (x > y) { y } else { z }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("alternative is not 1 statement. got=%d", len(exp.Alternative.Statements))
+	}
+
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T", exp.Alternative.Statements[0])
+	}
+
+	nested, ok := alternative.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("alternative is not ast.IfExpression. got=%T", alternative.Expression)
+	}
+
+	if !testInfixExpression(t, nested.Condition, "x", ">", "y") {
+		return
+	}
+
+	if nested.Alternative == nil || len(nested.Alternative.Statements) != 1 {
+		t.Fatalf("nested if has no else block")
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match (x + 1) {
+	1 => "one",
+	-2 => { let y = 2; y },
+	"a" => true,
+	_ => x,
+}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Subject, "x", "+", 1) {
+		return
+	}
+
+	expected := []string{
+		"1 => one",
+		"(-2) => let y = 2;y",
+		"a => true",
+		"_ => x",
+	}
+
+	if len(exp.Arms) != len(expected) {
+		t.Fatalf("wrong number of arms. want=%d, got=%d", len(expected), len(exp.Arms))
+	}
+	for i, want := range expected {
+		if exp.Arms[i].String() != want {
+			t.Errorf("arms[%d] wrong. want=%q, got=%q", i, want, exp.Arms[i].String())
+		}
+	}
+
+	if _, ok := exp.Arms[3].Pattern.(*ast.WildcardPattern); !ok {
+		t.Errorf("arms[3] pattern is not ast.WildcardPattern. got=%T", exp.Arms[3].Pattern)
+	}
+}
+
+func TestStructuralPatterns(t *testing.T) {
+	input := `match (x) {
+	[] => 0,
+	[a, 1, ...rest] => a,
+	[_, [b], ..._] if b > 1 => b,
+	{"type": "user", "name": n} => n,
+	{1: {"ok": true}, -2: _} => 1,
+	y if y == 2 => y,
+}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+	}
+
+	expected := []string{
+		"[] => 0",
+		"[a, 1, ...rest] => a",
+		"[_, [b], ..._] if (b > 1) => b",
+		"{type: user, name: n} => n",
+		"{1: {ok: true}, (-2): _} => 1",
+		"y if (y == 2) => y",
+	}
+
+	if len(exp.Arms) != len(expected) {
+		t.Fatalf("wrong number of arms. want=%d, got=%d", len(expected), len(exp.Arms))
+	}
+	for i, want := range expected {
+		if exp.Arms[i].String() != want {
+			t.Errorf("arms[%d] wrong. want=%q, got=%q", i, want, exp.Arms[i].String())
+		}
+	}
+
+	array, ok := exp.Arms[1].Pattern.(*ast.ArrayPattern)
+	if !ok {
+		t.Fatalf("arms[1] pattern is not ast.ArrayPattern. got=%T", exp.Arms[1].Pattern)
+	}
+	if !array.HasRest || array.Rest == nil || array.Rest.Value != "rest" {
+		t.Errorf("arms[1] rest wrong. got=%+v", array.Rest)
+	}
+	if _, ok := array.Elements[0].(*ast.IdentifierPattern); !ok {
+		t.Errorf("arms[1] elements[0] is not ast.IdentifierPattern. got=%T", array.Elements[0])
+	}
+
+	array = exp.Arms[2].Pattern.(*ast.ArrayPattern)
+	if !array.HasRest || array.Rest != nil {
+		t.Errorf("arms[2] rest should be unbound. got=%+v", array.Rest)
+	}
+
+	if _, ok := exp.Arms[3].Pattern.(*ast.HashPattern); !ok {
+		t.Errorf("arms[3] pattern is not ast.HashPattern. got=%T", exp.Arms[3].Pattern)
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -572,6 +891,49 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameterParsing(t *testing.T) {
+	tests := []struct {
+		input            string
+		expected         string
+		expectedParams   int
+		expectedDefaults int
+		expectedRest     string
+	}{
+		{"fn(a, b = 10) {}", "fn(a, b = 10)", 2, 1, ""},
+		{"fn(a = 1, b = a * 2) {}", "fn(a = 1, b = (a * 2))", 2, 2, ""},
+		{"fn(first, ...rest) {}", "fn(first, ...rest)", 1, 0, "rest"},
+		{"fn(...args) {}", "fn(...args)", 0, 0, "args"},
+		{"fn(a, b = [1, 2], ...rest) {}", "fn(a, b = [1, 2], ...rest)", 2, 1, "rest"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if function.String() != tt.expected {
+			t.Errorf("function.String() wrong. want=%q, got=%q", tt.expected, function.String())
+		}
+		if len(function.Parameters) != tt.expectedParams {
+			t.Errorf("length parameters wrong. want=%d, got=%d", tt.expectedParams, len(function.Parameters))
+		}
+		if len(function.Defaults) != tt.expectedDefaults {
+			t.Errorf("length defaults wrong. want=%d, got=%d", tt.expectedDefaults, len(function.Defaults))
+		}
+		if tt.expectedRest == "" {
+			if function.Rest != nil {
+				t.Errorf("function.Rest should be nil. got=%s", function.Rest)
+			}
+		} else if function.Rest == nil || function.Rest.Value != tt.expectedRest {
+			t.Errorf("function.Rest wrong. want=%s, got=%v", tt.expectedRest, function.Rest)
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -1037,3 +1399,80 @@ func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
 
 	return true
 }
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "1:7: expected next token to be =, got INT instead"},
+		{"let x = 1;\nadd(1, 2;", "2:9: expected next token to be ), got ; instead"},
+		{"let x = 1;\n\n  let = 5;", "3:7: expected next token to be IDENT, got = instead"},
+		{"let x = ;", "1:9: no prefix parse function for ; found"},
+		{"let x = 1;\n/* oops", "2:1: illegal token: unterminated block comment"},
+		{"let x = 1 # 2;", "1:11: illegal token: #"},
+		{"puts(\"unterminated);", "1:6: illegal token: unterminated string"},
+		{"let x = 1;\nbreak;", "2:1: break outside of a loop"},
+		{"1 + 2 = 3;", "1:7: cannot assign to (1 + 2)"},
+		{"match (x) { y + 1 => 2 }", "1:15: expected next token to be =>, got + instead"},
+		{"match (x) { fn => 2 }", "1:13: invalid pattern fn"},
+		{"let! x = 1;", "1:6: expected an array or hash pattern, got x"},
+		{"fn(a = 1, b) {}", "1:11: parameter b needs a default, as it follows one with a default"},
+		{"fn(...rest, a) {}", "1:11: expected next token to be ), got , instead"},
+		{"let [a, [1]] = xs;", "1:10: cannot bind to literal 1"},
+		{"match (x) { [...a, b] => 2 }", "1:18: expected next token to be ], got , instead"},
+		{"match (x) { {y: 1} => 2 }", "1:14: invalid hash pattern key y"},
+		{"match (x) { 1 => 2 3 => 4 }", "1:20: expected next token to be }, got INT instead"},
+		{"for (x, y, z in xs) {}", "1:10: expected next token to be IN, got , instead"},
+		{"while (true) { fn() { continue; } }", "1:23: continue outside of a loop"},
+		{"while (true) { fn(a = if (true) { break; }) { a } }", "1:35: break outside of a loop"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let x = 5;
+x + add(1,
+  y);`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[1].(*ast.ExpressionStatement)
+	infix := stmt.Expression.(*ast.InfixExpression)
+	call := infix.Right.(*ast.CallExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "1:1"},
+		{program.Statements[0].(*ast.LetStatement).Value, "1:9"},
+		{stmt, "2:1"},
+		{infix, "2:3"},
+		{call.Function, "2:5"},
+		{call.Arguments[1], "3:3"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.expected {
+			t.Errorf("tests[%d] - wrong position for %q. expected=%s, got=%s", i, tt.node.String(), tt.expected, tt.node.Pos())
+		}
+	}
+}
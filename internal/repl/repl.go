@@ -2,6 +2,7 @@ package repl
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 
@@ -20,9 +21,9 @@ func Start(in io.Reader, out io.Writer) {
 	constants := []object.Object{}
 	globals := make([]object.Object, vm.GlobalsSize)
 	symbolTable := compiler.NewSymbolTable()
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
-	}
+	symbolTable.DefineBuiltins(object.NewRegistry())
+	// script output goes to the same writer as the REPL's own output
+	scriptIO := &object.IO{Stdin: in, Stdout: out, Stderr: out}
 
 	for {
 		fmt.Fprint(out, PROMPT)
@@ -52,9 +53,10 @@ func Start(in io.Reader, out io.Writer) {
 		constants = code.Constants
 
 		machine := vm.NewWithGlobalStore(code, globals)
+		machine.SetIO(scriptIO)
 		err = machine.Run()
 		if err != nil {
-			fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
+			printRuntimeError(out, err)
 			continue
 		}
 
@@ -78,6 +80,17 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
+func printRuntimeError(out io.Writer, err error) {
+	io.WriteString(out, "Woops! Executing bytecode failed:\n")
+
+	var runtimeErr *vm.RuntimeError
+	if errors.As(err, &runtimeErr) {
+		io.WriteString(out, runtimeErr.Traceback()+"\n")
+		return
+	}
+	fmt.Fprintf(out, " %s\n", err)
+}
+
 func printParserErrors(out io.Writer, errors []string) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
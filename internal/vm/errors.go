@@ -0,0 +1,113 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// RuntimeError is returned by Run when executing the bytecode fails.
+// It wraps the underlying error and records the call stack at the point of failure.
+type RuntimeError struct {
+	Err error
+	// Trace holds one entry per active frame, outermost first
+	Trace []TraceEntry
+}
+
+// TraceEntry describes a single active frame of a RuntimeError.
+type TraceEntry struct {
+	// Function is the name of the function the frame is executing
+	Function string
+	// Offset is the instruction offset the frame was executing
+	Offset int
+	// Line and Column are the source position of that instruction, 0 when unknown
+	Line   int
+	Column int
+}
+
+func (e *RuntimeError) Error() string { return e.Err.Error() }
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// maxRepeatedEntries is the number of identical consecutive trace entries Traceback prints
+// before collapsing the rest, which keeps the traceback of a runaway recursion readable.
+const maxRepeatedEntries = 3
+
+// Traceback formats the error with its call stack, most recent call last.
+func (e *RuntimeError) Traceback() string {
+	var out bytes.Buffer
+
+	out.WriteString("Traceback (most recent call last):\n")
+	repeated := 0
+	for i, entry := range e.Trace {
+		if i > 0 && entry == e.Trace[i-1] {
+			repeated++
+		} else {
+			writeRepeated(&out, repeated)
+			repeated = 0
+		}
+		if repeated < maxRepeatedEntries {
+			out.WriteString("  " + entry.String() + "\n")
+		}
+	}
+	writeRepeated(&out, repeated)
+	out.WriteString("RuntimeError: " + e.Err.Error())
+
+	return out.String()
+}
+
+// writeRepeated notes how many identical entries were left out of a traceback.
+func writeRepeated(out *bytes.Buffer, repeated int) {
+	if omitted := repeated - maxRepeatedEntries + 1; omitted > 0 {
+		fmt.Fprintf(out, "  [previous entry repeated %d more times]\n", omitted)
+	}
+}
+
+func (te TraceEntry) String() string {
+	if te.Line == 0 {
+		return fmt.Sprintf("in %s (offset %04d)", te.Function, te.Offset)
+	}
+	return fmt.Sprintf("in %s at %d:%d (offset %04d)", te.Function, te.Line, te.Column, te.Offset)
+}
+
+// wrapError returns err as a *RuntimeError, keeping the trace of errors that already have one,
+// such as those raised inside a callback made by a builtin.
+func (vm *VM) wrapError(err error) *RuntimeError {
+	var runtimeErr *RuntimeError
+	if errors.As(err, &runtimeErr) {
+		return runtimeErr
+	}
+	return vm.newRuntimeError(err)
+}
+
+// newRuntimeError wraps err with a trace of the currently active frames.
+func (vm *VM) newRuntimeError(err error) *RuntimeError {
+	trace := []TraceEntry{}
+
+	for i := 0; i < vm.framesIndex && i < len(vm.frames); i++ {
+		frame := vm.frames[i]
+		// frames that haven't started yet, like the empty main frame of a VM only used for Call
+		if frame == nil || frame.ip < 0 {
+			continue
+		}
+
+		entry := TraceEntry{Function: frameFunctionName(frame, i), Offset: frame.ip}
+		if mapping, ok := frame.cl.Fn.SourceMap.Lookup(frame.ip); ok {
+			entry.Line = mapping.Line
+			entry.Column = mapping.Column
+		}
+		trace = append(trace, entry)
+	}
+
+	return &RuntimeError{Err: err, Trace: trace}
+}
+
+func frameFunctionName(frame *Frame, index int) string {
+	switch {
+	case index == 0:
+		return "<main>"
+	case frame.cl.Fn.Name != "":
+		return frame.cl.Fn.Name
+	default:
+		return "<anonymous>"
+	}
+}
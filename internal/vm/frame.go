@@ -11,6 +11,9 @@ type Frame struct {
 	ip int
 	// basePointer is the index of the bottom of the current frame
 	basePointer int
+	// numArgs is the number of parameters, not counting a rest parameter, the call passed
+	// arguments for
+	numArgs int
 }
 
 func NewFrame(cl *object.Closure, basePointer int) *Frame {
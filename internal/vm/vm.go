@@ -1,16 +1,25 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 
 	"github.com/natac13/monkey-compiler/internal/code"
 	"github.com/natac13/monkey-compiler/internal/compiler"
 	"github.com/natac13/monkey-compiler/internal/object"
 )
 
+// StackSize and MaxFrames are the default limits of a VM's stack and call depth,
+// see SetStackSize and SetMaxFrames.
 const StackSize = 2048
 const MaxFrames = 1024
 
+// the stack and frames start small and grow on demand up to their limits
+const initialStackSize = 256
+const initialFrames = 64
+
 // GlobalsSize is the size of the global variables store or 256 * 256,
 // as we are using 2 bytes to store the index of the global variable
 const GlobalsSize = 65536
@@ -19,6 +28,28 @@ var True = &object.Boolean{Value: true}
 var False = &object.Boolean{Value: false}
 var Null = &object.Null{}
 
+// cancelCheckInterval is the number of instructions executed between checks of the run's context.
+const cancelCheckInterval = 1024
+
+// ErrInstructionLimit is returned, wrapped in a *RuntimeError, when a run executes more
+// instructions than allowed by SetMaxInstructions.
+var ErrInstructionLimit = errors.New("instruction limit exceeded")
+
+// ErrMemoryLimit is returned, wrapped in a *RuntimeError, when a run allocates more memory
+// for strings, arrays and hashes than allowed by SetMemoryLimit.
+var ErrMemoryLimit = errors.New("memory limit exceeded")
+
+// ErrRecursionDepth is returned, wrapped in a *RuntimeError, when calls nest deeper than
+// the VM's frame limit, or use up its stack.
+var ErrRecursionDepth = errors.New("maximum recursion depth exceeded")
+
+// ErrStackOverflow is returned, wrapped in a *RuntimeError, when the main program
+// uses up the stack, e.g. with an array literal of more elements than the stack size.
+var ErrStackOverflow = errors.New("stack overflow")
+
+// defaultBuiltins serves OpGetBuiltin for VMs not given a registry. It is never registered into.
+var defaultBuiltins = object.NewRegistry()
+
 type VM struct {
 	constants []object.Object
 	stack     []object.Object
@@ -29,21 +60,47 @@ type VM struct {
 	// points to the next new frame's index.
 	// therefore the current frame is frames[framesIndex-1]
 	framesIndex int
+	// stackSize and maxFrames are the limits the stack and frames may grow to
+	stackSize int
+	maxFrames int
+	// builtins resolves OpGetBuiltin operands, it must be the registry the bytecode was compiled with
+	builtins *object.Registry
+	// io holds the streams used by builtins such as puts
+	io *object.IO
+	// ctx is the context of the current run, checked every cancelCheckInterval instructions
+	ctx context.Context
+	// maxInstructions limits the instructions executed in a run, 0 for no limit
+	maxInstructions int64
+	// executed counts the instructions executed since the run started
+	executed int64
+	// memoryLimit limits the bytes allocated in a run, 0 for no limit
+	memoryLimit int64
+	// allocated is the approximate number of bytes allocated since the run started
+	allocated int64
+	// hostErr is the error of the last failed Call or Allocate, checked by callBuiltin so that
+	// an error inside a callback or an exceeded limit stops the program, even if the builtin
+	// ignored it, as object.Host documents
+	hostErr error
 }
 
 func New(bytecode *compiler.ByteCode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
-	frames := make([]*Frame, MaxFrames)
+	frames := make([]*Frame, initialFrames)
 	frames[0] = mainFrame
 
 	return &VM{
 		constants:   bytecode.Constants,
-		stack:       make([]object.Object, StackSize),
+		stack:       make([]object.Object, initialStackSize),
+		stackSize:   StackSize,
+		maxFrames:   MaxFrames,
 		sp:          0,
 		globals:     make([]object.Object, GlobalsSize),
+		builtins:    defaultBuiltins,
+		io:          object.StandardIO(),
+		ctx:         context.Background(),
 		frames:      frames,
 		framesIndex: 1,
 	}
@@ -55,6 +112,14 @@ func NewWithGlobalStore(bytecode *compiler.ByteCode, s []object.Object) *VM {
 	return vm
 }
 
+// NewWithState returns a VM using the given globals store and builtin registry,
+// for bytecode compiled with compiler.NewWithState against the same registry.
+func NewWithState(bytecode *compiler.ByteCode, s []object.Object, builtins *object.Registry) *VM {
+	vm := NewWithGlobalStore(bytecode, s)
+	vm.builtins = builtins
+	return vm
+}
+
 func (vm *VM) StackTop() object.Object {
 	if vm.sp == 0 {
 		return nil
@@ -63,7 +128,140 @@ func (vm *VM) StackTop() object.Object {
 	return vm.stack[vm.sp-1]
 }
 
+// SetStackSize sets the number of values the stack may hold, StackSize by default.
+// It must be called before running the VM.
+func (vm *VM) SetStackSize(n int) {
+	vm.stackSize = n
+	if len(vm.stack) > n {
+		vm.stack = vm.stack[:n]
+	}
+}
+
+// SetMaxFrames sets the maximum call depth, MaxFrames by default.
+// It must be called before running the VM.
+func (vm *VM) SetMaxFrames(n int) {
+	vm.maxFrames = n
+}
+
+// SetMaxInstructions limits the number of instructions a run may execute, 0 for no limit.
+// Exceeding it stops the run with ErrInstructionLimit.
+func (vm *VM) SetMaxInstructions(n int64) {
+	vm.maxInstructions = n
+}
+
+// SetMemoryLimit limits the approximate number of bytes a run may allocate for strings,
+// arrays and hashes, 0 for no limit. Exceeding it stops the run with ErrMemoryLimit.
+// Memory is counted when allocated and never released, so the limit also bounds garbage.
+// Constants aren't counted: they are made by the compiler, bounded by the size of the
+// source, and shared by every use rather than copied.
+func (vm *VM) SetMemoryLimit(n int64) {
+	vm.memoryLimit = n
+}
+
+// Run executes the bytecode. Runtime errors in the program are returned as a *RuntimeError,
+// and so is any Go panic raised while executing it, so a broken program can't take down the host.
 func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext is like Run, but stops with the context's error once ctx is done.
+// The error wraps ctx.Err(), so it can be checked with errors.Is(err, context.DeadlineExceeded).
+// The context also applies to calls builtins make with Call during the run.
+func (vm *VM) RunContext(ctx context.Context) (err error) {
+	outerCtx := vm.ctx
+	vm.ctx = ctx
+	vm.executed = 0
+	vm.allocated = 0
+
+	defer func() {
+		vm.ctx = outerCtx
+		if r := recover(); r != nil {
+			err = vm.newRuntimeError(fmt.Errorf("internal vm error: %v", r))
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return vm.newRuntimeError(fmt.Errorf("execution canceled: %w", err))
+	}
+	if err := vm.run(0); err != nil {
+		return vm.wrapError(err)
+	}
+	return nil
+}
+
+// SetIO sets the streams used by builtins, which default to the process's standard streams.
+func (vm *VM) SetIO(io *object.IO) {
+	vm.io = io
+}
+
+// IO returns the streams used by builtins. Together with Call it makes the VM the object.Host of its builtins.
+func (vm *VM) IO() *object.IO {
+	return vm.io
+}
+
+// Allocate accounts for size bytes allocated by a builtin, see object.Host.
+func (vm *VM) Allocate(size int64) error {
+	err := vm.allocate(size)
+	if err != nil {
+		vm.hostErr = err
+	}
+	return err
+}
+
+func (vm *VM) allocate(size int64) error {
+	vm.allocated += size
+	if vm.memoryLimit > 0 && vm.allocated > vm.memoryLimit {
+		return fmt.Errorf("%w: allocated %d bytes, the limit is %d", ErrMemoryLimit, vm.allocated, vm.memoryLimit)
+	}
+	return nil
+}
+
+// Call calls fn, a closure or builtin, with args and runs it until it returns.
+// It can be used from Go between runs, or re-entrantly by a builtin while Run is executing,
+// which is how builtins such as map call back into Monkey functions.
+// Errors are returned as a *RuntimeError and leave the VM ready for further calls.
+func (vm *VM) Call(fn object.Object, args ...object.Object) (result object.Object, err error) {
+	sp, framesIndex := vm.sp, vm.framesIndex
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = vm.newRuntimeError(fmt.Errorf("internal vm error: %v", r))
+		}
+		if err != nil {
+			vm.hostErr = err
+			vm.sp, vm.framesIndex = sp, framesIndex
+		}
+	}()
+
+	if err := vm.push(fn); err != nil {
+		return nil, vm.wrapError(err)
+	}
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return nil, vm.wrapError(err)
+		}
+	}
+
+	if err := vm.executeCall(len(args)); err != nil {
+		return nil, vm.wrapError(err)
+	}
+
+	// a closure pushed a new frame that has to run until it returns,
+	// a builtin has already left its result on the stack
+	if vm.framesIndex > framesIndex {
+		if err := vm.run(framesIndex); err != nil {
+			return nil, vm.wrapError(err)
+		}
+	}
+
+	result = vm.pop()
+	vm.sp = sp
+	return result, nil
+}
+
+// run executes instructions until the main frame runs out of instructions,
+// or until a return leaves only stopFrame frames on the frame stack.
+func (vm *VM) run(stopFrame int) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
@@ -74,6 +272,16 @@ func (vm *VM) Run() error {
 		ins = vm.currentFrame().Instructions()
 		op = code.Opcode(ins[ip])
 
+		vm.executed++
+		if vm.maxInstructions > 0 && vm.executed > vm.maxInstructions {
+			return ErrInstructionLimit
+		}
+		if vm.executed%cancelCheckInterval == 0 {
+			if err := vm.ctx.Err(); err != nil {
+				return fmt.Errorf("execution canceled: %w", err)
+			}
+		}
+
 		switch op {
 		case code.OpConstant:
 			constIndex := code.ReadUint16(ins[ip+1:])
@@ -84,13 +292,13 @@ func (vm *VM) Run() error {
 				return err
 			}
 
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
 				return err
 			}
 
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanEqual:
 			err := vm.executeComparison(op)
 			if err != nil {
 				return err
@@ -134,6 +342,26 @@ func (vm *VM) Run() error {
 			// we subtract 1 because the loop will increment the instruction pointer on the next iteration
 			vm.currentFrame().ip = pos - 1
 
+		case code.OpStackDepth:
+			depth := vm.sp - vm.currentFrame().basePointer
+			err := vm.push(&object.Integer{Value: int64(depth)})
+			if err != nil {
+				return err
+			}
+
+		case code.OpUnwindStack:
+			depth := vm.pop().(*object.Integer)
+			vm.sp = vm.currentFrame().basePointer + int(depth.Value)
+
+		case code.OpJumpIfPassed:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			param := int(code.ReadUint8(ins[ip+3:]))
+			vm.currentFrame().ip += 3
+
+			if param < vm.currentFrame().numArgs {
+				vm.currentFrame().ip = pos - 1
+			}
+
 		case code.OpJumpNotTruthy:
 			pos := int(code.ReadUint16(ins[ip+1:]))
 			// we add 2 because the jump instructions are followed by 2 bytes that represent the jump offset
@@ -144,6 +372,27 @@ func (vm *VM) Run() error {
 				vm.currentFrame().ip = pos - 1
 			}
 
+		case code.OpGetIter:
+			iterable := vm.pop()
+			iterator, ok := object.NewIterator(iterable)
+			if !ok {
+				return fmt.Errorf("cannot iterate over %s", iterable.Type())
+			}
+
+			err := vm.push(iterator)
+			if err != nil {
+				return err
+			}
+
+		case code.OpIterNext:
+			numVariables := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			err := vm.executeIterNext(numVariables)
+			if err != nil {
+				return err
+			}
+
 		case code.OpSetGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
@@ -163,10 +412,14 @@ func (vm *VM) Run() error {
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
 
+			err := vm.allocate(object.ArraySize(numElements))
+			if err != nil {
+				return err
+			}
 			array := vm.buildArray(vm.sp-numElements, vm.sp)
 			vm.sp = vm.sp - numElements
 
-			err := vm.push(array)
+			err = vm.push(array)
 			if err != nil {
 				return err
 			}
@@ -175,6 +428,10 @@ func (vm *VM) Run() error {
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
 
+			err := vm.allocate(object.HashSize(numElements / 2))
+			if err != nil {
+				return err
+			}
 			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
 			if err != nil {
 				return err
@@ -194,6 +451,83 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpDup:
+			count := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			base := vm.sp - count
+			for i := 0; i < count; i++ {
+				err := vm.push(vm.stack[base+i])
+				if err != nil {
+					return err
+				}
+			}
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpMatchArray:
+			length := int(code.ReadUint16(ins[ip+1:]))
+			hasRest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			array, ok := vm.stack[vm.sp-1].(*object.Array)
+			matched := ok && (len(array.Elements) == length || hasRest && len(array.Elements) > length)
+			err := vm.push(nativeBoolToBooleanObject(matched))
+			if err != nil {
+				return err
+			}
+
+		case code.OpMatchHash:
+			_, ok := vm.stack[vm.sp-1].(*object.Hash)
+			err := vm.push(nativeBoolToBooleanObject(ok))
+			if err != nil {
+				return err
+			}
+
+		case code.OpHasKey:
+			key := vm.pop()
+			hash := vm.pop()
+
+			err := vm.executeHasKey(hash, key)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSlice:
+			start := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			err := vm.executeSlice(vm.pop(), start)
+			if err != nil {
+				return err
+			}
+
+		case code.OpDestructureArray, code.OpDestructureHash:
+			strict := code.ReadUint8(ins[ip+1:]) == 1
+			vm.currentFrame().ip++
+
+			err := vm.executeDestructure(op, strict)
+			if err != nil {
+				return err
+			}
+
+		case code.OpIndexStrict:
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeStrictIndex(left, index)
+			if err != nil {
+				return err
+			}
+
 		case code.OpCall:
 			numArgs := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip++ // hack for now
@@ -213,6 +547,9 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+			if vm.framesIndex == stopFrame {
+				return nil
+			}
 
 		case code.OpReturn:
 			frame := vm.popFrame()
@@ -221,6 +558,9 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+			if vm.framesIndex == stopFrame {
+				return nil
+			}
 
 		case code.OpSetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
@@ -237,11 +577,37 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpMakeCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = &object.Cell{Value: vm.pop()}
+
+		case code.OpGetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			frame := vm.currentFrame()
+			cell := vm.stack[frame.basePointer+int(localIndex)].(*object.Cell)
+			err := vm.push(cell.Value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			frame := vm.currentFrame()
+			cell := vm.stack[frame.basePointer+int(localIndex)].(*object.Cell)
+			cell.Value = vm.pop()
+
 		case code.OpGetBuiltin:
 			builtinIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip++
-			defintion := object.Builtins[builtinIndex]
-			err := vm.push(defintion.Builtin)
+			builtin, ok := vm.builtins.Get(int(builtinIndex))
+			if !ok {
+				return fmt.Errorf("undefined builtin %d", builtinIndex)
+			}
+			err := vm.push(builtin)
 			if err != nil {
 				return err
 			}
@@ -264,6 +630,21 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			cell := vm.currentFrame().cl.Free[freeIndex].(*object.Cell)
+			err := vm.push(cell.Value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+			cell := vm.currentFrame().cl.Free[freeIndex].(*object.Cell)
+			cell.Value = vm.pop()
+
 		case code.OpCurrentClosure:
 			currentClosure := vm.currentFrame().cl
 			err := vm.push(currentClosure)
@@ -277,8 +658,11 @@ func (vm *VM) Run() error {
 }
 
 func (vm *VM) push(o object.Object) error {
-	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+	if vm.sp >= len(vm.stack) {
+		err := vm.growStack(vm.sp + 1)
+		if err != nil {
+			return err
+		}
 	}
 
 	vm.stack[vm.sp] = o
@@ -287,6 +671,31 @@ func (vm *VM) push(o object.Object) error {
 	return nil
 }
 
+// growStack makes room for at least size values on the stack, up to the stack size limit.
+func (vm *VM) growStack(size int) error {
+	if size > vm.stackSize {
+		// only deep recursion can use up the stack in a function, a single frame
+		// uses far less than the stack size
+		if vm.framesIndex > 1 {
+			return ErrRecursionDepth
+		}
+		return ErrStackOverflow
+	}
+
+	newSize := 2 * len(vm.stack)
+	if newSize < size {
+		newSize = size
+	}
+	if newSize > vm.stackSize {
+		newSize = vm.stackSize
+	}
+
+	stack := make([]object.Object, newSize)
+	copy(stack, vm.stack)
+	vm.stack = stack
+	return nil
+}
+
 func (vm *VM) pop() object.Object {
 	o := vm.stack[vm.sp-1]
 	vm.sp--
@@ -307,6 +716,8 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	switch {
 	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
 		return vm.executeBinaryIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeBinaryFloatOperation(op, left, right)
 	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
 		return vm.executeBinaryStringOperation(op, left, right)
 	default:
@@ -328,7 +739,15 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 	case code.OpMul:
 		result = leftValue * rightValue
 	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
 		result = leftValue / rightValue
+	case code.OpMod:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		result = leftValue % rightValue
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
@@ -336,6 +755,46 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 	return vm.push(&object.Integer{Value: result})
 }
 
+// executeBinaryFloatOperation handles arithmetic where at least one operand is a float.
+// Integer operands are promoted to floats.
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	var result float64
+
+	switch op {
+	case code.OpAdd:
+		result = leftValue + rightValue
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		result = leftValue / rightValue
+	case code.OpMod:
+		result = math.Mod(leftValue, rightValue)
+	default:
+		return fmt.Errorf("unknown float operator: %d", op)
+	}
+
+	return vm.push(&object.Float{Value: result})
+}
+
+func (vm *VM) executeStringComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+	}
+}
+
 func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
 	if op != code.OpAdd {
 		return fmt.Errorf("unknown string operator: %d", op)
@@ -344,6 +803,10 @@ func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Ob
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
 
+	err := vm.allocate(object.StringSize(len(leftValue) + len(rightValue)))
+	if err != nil {
+		return err
+	}
 	return vm.push(&object.String{Value: leftValue + rightValue})
 }
 
@@ -358,6 +821,14 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 		return vm.executeIntegerComparsion(op, left, right)
 	}
 
+	if isNumber(left) && isNumber(right) {
+		return vm.executeFloatComparison(op, left, right)
+	}
+
+	if leftType == object.STRING_OBJ && rightType == object.STRING_OBJ {
+		return vm.executeStringComparison(op, left, right)
+	}
+
 	switch op {
 	case code.OpEqual:
 		return vm.push(nativeBoolToBooleanObject(right == left))
@@ -379,11 +850,48 @@ func (vm *VM) executeIntegerComparsion(op code.Opcode, left, right object.Object
 		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
 	case code.OpGreaterThan:
 		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
 }
 
+func (vm *VM) executeFloatComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	default:
+		return fmt.Errorf("unknown float operator: %d", op)
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	t := obj.Type()
+	return t == object.INTEGER_OBJ || t == object.FLOAT_OBJ
+}
+
+// toFloat converts an Integer or Float to a float64. Callers check isNumber first.
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Float:
+		return obj.Value
+	case *object.Integer:
+		return float64(obj.Value)
+	default:
+		return 0
+	}
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return True
@@ -410,12 +918,14 @@ func (vm *VM) executeBangOperator() error {
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
 
-	if operand.Type() != object.INTEGER_OBJ {
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
 		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
 	}
-
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
 }
 
 func isTruthy(obj object.Object) bool {
@@ -492,13 +1002,153 @@ func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	return vm.push(pair.Value)
 }
 
+// executeSetIndex sets the element of an array or hash at index to value, and pushes value.
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return fmt.Errorf("index out of range: %d with length %d", i.Value, len(left.Elements))
+		}
+		left.Elements[i.Value] = value
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %T (%s)", index, index.Type())
+		}
+		hashKey := key.HashKey()
+		if _, ok := left.Pairs[hashKey]; !ok {
+			// account for the pair added to the hash
+			err := vm.allocate(object.HashSize(1) - object.HashSize(0))
+			if err != nil {
+				return err
+			}
+		}
+		left.Pairs[hashKey] = object.HashPair{Key: index, Value: value}
+
+	default:
+		return fmt.Errorf("index assignment not supported: %s", left.Type())
+	}
+
+	return vm.push(value)
+}
+
+// executeHasKey pushes whether hash has the key, for hash patterns.
+func (vm *VM) executeHasKey(hash, key object.Object) error {
+	hashObject, ok := hash.(*object.Hash)
+	if !ok {
+		return fmt.Errorf("key lookup not supported: %s", hash.Type())
+	}
+	hashKey, ok := key.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %T (%s)", key, key.Type())
+	}
+	_, ok = hashObject.Pairs[hashKey.HashKey()]
+	return vm.push(nativeBoolToBooleanObject(ok))
+}
+
+// executeSlice pushes a new array of the elements of array from start on, for the rest
+// of an array pattern.
+func (vm *VM) executeSlice(array object.Object, start int) error {
+	arrayObject, ok := array.(*object.Array)
+	if !ok {
+		return fmt.Errorf("slice not supported: %s", array.Type())
+	}
+	if start > len(arrayObject.Elements) {
+		start = len(arrayObject.Elements)
+	}
+
+	elements := make([]object.Object, len(arrayObject.Elements)-start)
+	copy(elements, arrayObject.Elements[start:])
+
+	err := vm.allocate(object.ArraySize(len(elements)))
+	if err != nil {
+		return err
+	}
+	return vm.push(&object.Array{Elements: elements})
+}
+
+// executeDestructure checks the value at the top of the stack is an array, for
+// OpDestructureArray, or a hash, for OpDestructureHash. Unless strict, null is replaced
+// by an empty array or hash, so all the names of the pattern are bound to null.
+func (vm *VM) executeDestructure(op code.Opcode, strict bool) error {
+	value := vm.stack[vm.sp-1]
+
+	want := object.ARRAY_OBJ
+	if op == code.OpDestructureHash {
+		want = object.HASH_OBJ
+	}
+	if value.Type() == want {
+		return nil
+	}
+	if value != Null || strict {
+		return fmt.Errorf("cannot destructure %s as %s", value.Type(), want)
+	}
+
+	if want == object.ARRAY_OBJ {
+		err := vm.allocate(object.ArraySize(0))
+		if err != nil {
+			return err
+		}
+		vm.stack[vm.sp-1] = &object.Array{Elements: []object.Object{}}
+	} else {
+		err := vm.allocate(object.HashSize(0))
+		if err != nil {
+			return err
+		}
+		vm.stack[vm.sp-1] = &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
+	}
+	return nil
+}
+
+// executeStrictIndex pushes the element of an array or hash at index, which must exist.
+func (vm *VM) executeStrictIndex(left, index object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return fmt.Errorf("index out of range: %d with length %d", i.Value, len(left.Elements))
+		}
+		return vm.push(left.Elements[i.Value])
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %T (%s)", index, index.Type())
+		}
+		pair, ok := left.Pairs[key.HashKey()]
+		if !ok {
+			return fmt.Errorf("missing key %s", index.Inspect())
+		}
+		return vm.push(pair.Value)
+
+	default:
+		return fmt.Errorf("index operator not supported: %s", left.Type())
+	}
+}
+
 func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIndex-1]
 }
 
-func (vm *VM) pushFrame(f *Frame) {
-	vm.frames[vm.framesIndex] = f
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= vm.maxFrames {
+		return ErrRecursionDepth
+	}
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
 	vm.framesIndex++
+	return nil
 }
 
 func (vm *VM) popFrame() *Frame {
@@ -507,19 +1157,77 @@ func (vm *VM) popFrame() *Frame {
 }
 
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
-	if numArgs != cl.Fn.NumParameters {
-		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	fn := cl.Fn
+	if numArgs < fn.NumParameters-fn.NumDefaults || numArgs > fn.NumParameters && !fn.Variadic {
+		return fmt.Errorf("wrong number of arguments: want=%s, got=%d", arity(fn), numArgs)
 	}
 	frame := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(frame)
+	// the locals are reserved on the stack above the arguments
+	if top := frame.basePointer + cl.Fn.NumLocals; top > len(vm.stack) {
+		if err := vm.growStack(top); err != nil {
+			return ErrRecursionDepth
+		}
+	}
+
+	frame.numArgs = min(numArgs, fn.NumParameters)
+	// the parameters left out are filled in with their defaults by the function
+	for i := numArgs; i < fn.NumParameters; i++ {
+		vm.stack[frame.basePointer+i] = Null
+	}
+	if fn.Variadic {
+		err := vm.packRest(frame.basePointer+fn.NumParameters, frame.basePointer+numArgs)
+		if err != nil {
+			return err
+		}
+	}
+	err := vm.pushFrame(frame)
+	if err != nil {
+		return err
+	}
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
 	return nil
 }
 
+// packRest replaces the extra arguments of a call, from start to end on the stack, with an
+// array of them for the rest parameter at start.
+func (vm *VM) packRest(start, end int) error {
+	elements := []object.Object{}
+	if end > start {
+		elements = make([]object.Object, end-start)
+		copy(elements, vm.stack[start:end])
+	}
+
+	err := vm.allocate(object.ArraySize(len(elements)))
+	if err != nil {
+		return err
+	}
+	vm.stack[start] = &object.Array{Elements: elements}
+	return nil
+}
+
+// arity describes the numbers of arguments fn accepts, for errors.
+func arity(fn *object.CompiledFunction) string {
+	required := fn.NumParameters - fn.NumDefaults
+	switch {
+	case fn.Variadic:
+		return fmt.Sprintf("at least %d", required)
+	case fn.NumDefaults > 0:
+		return fmt.Sprintf("%d to %d", required, fn.NumParameters)
+	default:
+		return fmt.Sprintf("%d", required)
+	}
+}
+
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	// get args from the stack without removing them
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	result := builtin.Fn(args...)
+	vm.hostErr = nil
+	result := builtin.Fn(vm, args...)
+	// a callback that failed aborts the program instead of becoming the builtin's result
+	if err := vm.hostErr; err != nil {
+		vm.hostErr = nil
+		return err
+	}
 	// decrease the stack pointer to remove the arguments and the function from the stack
 	vm.sp = vm.sp - numArgs - 1
 	if result != nil {
@@ -558,3 +1266,55 @@ func (vm *VM) pushClosure(constIndex, numFree int) error {
 	closure := &object.Closure{Fn: function, Free: free}
 	return vm.push(closure)
 }
+
+// executeIterNext pops an iterator and advances it, pushing the values of numVariables
+// loop variables and True, or only False once the iterator is exhausted.
+func (vm *VM) executeIterNext(numVariables int) error {
+	top := vm.pop()
+	iterator, ok := top.(*object.Iterator)
+	if !ok {
+		return fmt.Errorf("not an iterator: %s", top.Type())
+	}
+
+	if numVariables == 1 {
+		value, ok := iterator.Next()
+		if !ok {
+			return vm.push(False)
+		}
+		err := vm.allocateIterValue(iterator, value)
+		if err != nil {
+			return err
+		}
+		err = vm.push(value)
+		if err != nil {
+			return err
+		}
+	} else {
+		key, value, ok := iterator.NextPair()
+		if !ok {
+			return vm.push(False)
+		}
+		err := vm.allocateIterValue(iterator, value)
+		if err != nil {
+			return err
+		}
+		err = vm.push(key)
+		if err != nil {
+			return err
+		}
+		err = vm.push(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return vm.push(True)
+}
+
+// allocateIterValue accounts for an element made by iterator, such as a character of a string.
+func (vm *VM) allocateIterValue(iterator *object.Iterator, value object.Object) error {
+	if !iterator.MakesValues() {
+		return nil
+	}
+	return vm.allocate(object.SizeOf(value))
+}
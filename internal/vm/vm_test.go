@@ -1,11 +1,17 @@
 package vm
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/natac13/monkey-compiler/internal/ast"
+	"github.com/natac13/monkey-compiler/internal/code"
 	"github.com/natac13/monkey-compiler/internal/compiler"
+	"github.com/natac13/monkey-compiler/internal/evaluator"
 	"github.com/natac13/monkey-compiler/internal/lexer"
 	"github.com/natac13/monkey-compiler/internal/object"
 	"github.com/natac13/monkey-compiler/internal/parser"
@@ -34,6 +40,28 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"-10", -10},
 		{"-50 + 100 + -50", 0},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"10 + 9 % 4 * 2", 12},
+		{"7.5 % 2", 1.5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5", 1.5},
+		{"-2.5", -2.5},
+		{"1.5 + 2.25", 3.75},
+		{"1.5 - 2", -0.5},
+		{"2 * 0.25", 0.5},
+		{"7 / 2.0", 3.5},
+		{"0.5 * 3 + 1", 2.5},
+		{"1.5 > 1", true},
+		{"1 < 1.5", true},
+		{"2 == 2.0", true},
+		{"2.5 != 2.5", false},
 	}
 
 	runVmTests(t, tests)
@@ -67,6 +95,27 @@ func TestBooleanExpressions(t *testing.T) {
 		{"!!false", false},
 		{"!!5", true},
 		{"!(if (false) { 5; })", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"2.5 >= 2", true},
+		{"2 <= 1.5", false},
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"1 && 2", true},
+		{"true || false", true},
+		{"false || false", false},
+		{"false || 1", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"false && fn(a) { a }()", false},
+		{"true || fn(a) { a }()", true},
+		{"\"a\" + \"b\" == \"ab\"", true},
+		{"\"a\" != \"a\"", false},
+		{"\"a\" == 1", false},
 	}
 
 	runVmTests(t, tests)
@@ -84,6 +133,180 @@ func TestConditionals(t *testing.T) {
 		{"if (1 > 2) { 10 }", Null},
 		{"if (false) { 10 }", Null},
 		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 } else { 30 }", 30},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 }", Null},
+		{"if (true) { let x = 1; }", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"match (2) { 1 => 10, 2 => 20, _ => 30 }", 20},
+		{"match (5) { 1 => 10, 2 => 20, _ => 30 }", 30},
+		{"match (5) { 1 => 10 }", Null},
+		{"match (\"b\") { \"a\" => 1, \"b\" => 2 }", 2},
+		{"match (1 + 1) { true => 1, \"2\" => 2, 2.0 => 3 }", 3},
+		{"match (-1) { -1 => \"neg\", _ => \"pos\" }", "neg"},
+		{"match (1) { 1 => { let x = 5; x * 2 } }", 10},
+		{"match (1) { 1 => { let x = 5; } }", Null},
+		{"let f = fn(x) { match (x) { 0 => \"zero\", _ => \"many\" } }; f(0) + f(3)", "zeromany"},
+		{"let f = fn() { let n = 0; for (x in [1, 2, 3]) { match (x) { 2 => { continue; }, _ => { n += x } } } n }; f()", 4},
+		{"let f = fn() { for (x in [1, 2, 3]) { match (x) { 2 => { return x * 100; } } } }; f()", 200},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStructuralPatterns(t *testing.T) {
+	tests := []vmTestCase{
+		{"match ([1, 2]) { [a, b] => a + b }", 3},
+		{"match ([1, 2, 3]) { [a, b] => 0, [a, b, c] => c }", 3},
+		{"match ([]) { [] => \"empty\", _ => \"other\" }", "empty"},
+		{"match ([1, 2, 3]) { [first, ...rest] => rest }", []int{2, 3}},
+		{"match ([1]) { [first, ...rest] => len(rest) }", 0},
+		{"match ([1]) { [a, b, ...rest] => 1, _ => 2 }", 2},
+		{"match ([1, 2, 3]) { [1, ..._] => true }", true},
+		{"match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }", 6},
+		{"match ([1, [2]]) { [a, [b, c]] => 1, [a, [b]] => b }", 2},
+		{"match ([1, 2]) { [2, b] => 1, [_, 2] => 2 }", 2},
+		{"match (\"ab\") { [a, b] => 1, _ => 2 }", 2},
+		{"match ({\"type\": \"user\", \"name\": \"ann\"}) { {\"type\": \"admin\"} => \"admin\", {\"type\": \"user\", \"name\": n} => n }", "ann"},
+		{"match ({\"a\": 1}) { {\"b\": _} => 1, {} => 2 }", 2},
+		{"match ({\"a\": [1, 2]}) { {\"a\": [x, y]} => x * y }", 2},
+		{"match ({\"a\": {\"b\": 1}}) { {\"a\": {\"b\": 2}} => 1, {\"a\": {\"b\": b}} => b + 10 }", 11},
+		{"match ([1]) { {} => 1, _ => 2 }", 2},
+		{"match (5) { x if x > 10 => \"big\", x if x > 0 => \"small\", _ => \"neg\" }", "small"},
+		{"match ([3, 4]) { [a, b] if a > b => a, [a, b] => b }", 4},
+		{"let f = fn(event) { match (event) { {\"kind\": \"add\", \"value\": v} => v, {\"kind\": \"sub\", \"value\": v} => -v, _ => 0 } }; f({\"kind\": \"add\", \"value\": 2}) + f({\"kind\": \"sub\", \"value\": 5}) + f({})", -3},
+		{"let f = fn(p) { match (p) { [a, b] => fn() { a + b } } }; f([1, 2])()", 3},
+		{"let f = fn(p) { match (p) { [a, ...rest] => { let g = fn() { rest = push(rest, a) }; g(); rest } } }; f([1, 2])", []int{2, 1}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; while (false) { 1 }; i", 0},
+		{"let sum = fn(n) { let i = 0; let s = 0; while (i < n) { let i = i + 1; let s = s + i; } s }; sum(10)", 55},
+		{"let f = fn() { let i = 0; while (true) { let i = i + 1; if (i == 5) { break; } } i }; f()", 5},
+		{"let f = fn() { let i = 0; let s = 0; while (i < 10) { let i = i + 1; if (i % 2 == 0) { continue; } let s = s + i; } s }; f()", 25},
+		{"let f = fn() { let i = 0; while (true) { let i = i + 1; if (i == 3) { return i * 10; } } }; f()", 30},
+		{"let f = fn() { let i = 0; let n = 0; while (i < 3) { let i = i + 1; let j = 0; while (true) { let j = j + 1; if (j > 4) { break; } let n = n + 1; } } n }; f()", 12},
+		{"let f = fn() { let i = 0; while (i < 10000) { let i = i + 1; } i }; f()", 10000},
+		{"let f = fn() { while (false) { } }; f()", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let s = 0; for (x in [1, 2, 3]) { let s = s + x; }; s", 6},
+		{"let s = 0; for (i, x in [10, 20, 30]) { let s = s + i * x; }; s", 80},
+		{"let s = \"\"; for (k in {\"b\": 1, \"a\": 2, \"c\": 3}) { let s = s + k; }; s", "abc"},
+		{"let s = \"\"; for (k, v in {2: \"b\", 1: \"a\", true: \"t\"}) { let s = s + v; }; s", "tab"},
+		{"let s = \"\"; for (ch in \"héllo\") { let s = ch + s; }; s", "olléh"},
+		{"let n = 0; for (i, ch in \"héllo\") { let n = i; }; n", 4},
+		{"let f = fn(xs) { let s = 0; for (x in xs) { if (x > 3) { break; } if (x == 2) { continue; } let s = s + x; } s }; f([1, 2, 3, 4, 5])", 4},
+		{"let f = fn(xs) { for (x in xs) { if (x > 1) { return x * 10; } } }; f([1, 2, 3])", 20},
+		{"let f = fn() { let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { let n = n + x * y; } } n }; f()", 18},
+		{"let f = fn(xs) { for (x in xs) { } }; f([])", Null},
+		// every iteration assigns the same binding
+		{"let fs = []; for (x in [1, 2, 3]) { let fs = push(fs, fn() { x }) }; fs[0]()", 3},
+		{"let f = fn() { let fs = []; for (x in [1, 2, 3]) { fs = push(fs, fn() { x }) }; fs[0]() }; f()", 3},
+		{"let fs = []; for (x in [1, 2, 3]) { let fs = push(fs, fn(x) { fn() { x } }(x)) }; fs[0]()", 1},
+		{"for (x in [1, 2, 3]) { }; x", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLoopExitsInExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; while (i < 5000) { let i = i + 1; [1, if (true) { continue; }] }; i", 5000},
+		{"let i = 0; let n = 0; while (i < 5000) { i += 1; n = n + 1 + match (i) { _ => { continue; } } }; n", 0},
+		{"let g = fn(a, b, c) { a }; let i = 0; while (true) { let i = i + 1; g(1, 2, if (i == 3) { break; }) }; i", 3},
+		{"let f = fn() { let i = 0; while (i < 5000) { let i = i + 1; i + if (true) { continue; } } i }; f()", 5000},
+		{"let f = fn() { let s = 0; for (x in [1, 2, 3]) { let s = s + x * if (x == 2) { continue; } else { 1 } } s }; f()", 4},
+		{"let f = fn() { let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { let n = n + [x, if (y == 2) { break; } else { y }][1] } } n }; f()", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDefaultsInBothEngines(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// defaults run from left to right and see null for the parameters after them
+		{"let f = fn(a = b, b = 1) { [a, b] }; f()", "[null, 1]"},
+		{"let b = 5; let f = fn(a = b, b = 1) { a }; f()", "null"},
+		{"let f = fn(a, b = a * 2, c = a + b) { [a, b, c] }; f(1)", "[1, 2, 3]"},
+		{"let f = fn(a = fn() { b }, b = 1) { a() }; f()", "1"},
+		{"let f = fn(a = len(rest), ...rest) { a }; f()", "0"},
+		{"let f = fn(a = if (true) { return 7; }) { a + 1 }; f()", "7"},
+		{"let f = fn(a = f = 3) { a }; [f(), f]", "[3, 3]"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.ByteCode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("%q: wrong vm result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+
+		evaluated := evaluator.Eval(program, object.NewEnvironment())
+		if got := evaluated.Inspect(); got != tt.expected {
+			t.Errorf("%q: wrong evaluator result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestRedefinitions(t *testing.T) {
+	tests := []vmTestCase{
+		// redefining a name reuses its binding, so earlier closures see the new value
+		{"let x = 1; let x = x + 1; x", 2},
+		{"let x = 1; let f = fn() { x }; let x = 2; f()", 2},
+		{"let g = fn() { let x = 1; let x = x * 10; x }; g()", 10},
+		{"let g = fn(a) { let a = a + 1; a }; g(1)", 2},
+		{"let g = fn() { let x = 1; let f = fn() { x }; let x = 2; f() }; g()", 2},
+		{"let g = fn() { let x = 1; let f = fn() { x }; let x = 2; let h = fn() { x }; f() + h() }; g()", 4},
+		{"let g = fn(x) { let f = fn() { x }; let x = x + 1; f() }; g(1)", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; let y = x = 5; x + y", 10},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", 6},
+		{"let s = \"a\"; s += \"b\"; s", "ab"},
+		{"let f = fn() { let n = 0; let i = 0; while (i < 5) { i += 1; n = n + i; } n }; f()", 15},
+		{"let f = fn(a) { a = a * 2; a }; f(21)", 42},
+		{"let a = [1, 2, 3]; a[1] = 20; a[2] += 10; a", []int{1, 20, 13}},
+		{"let h = {}; h[\"a\"] = 1; h[\"a\"] += 1; h[\"b\"] = 3; h", map[object.HashKey]int64{
+			(&object.String{Value: "a"}).HashKey(): 2,
+			(&object.String{Value: "b"}).HashKey(): 3,
+		}},
+		{"let a = [0]; let i = 0; a[i = 0] += 1; a", []int{1}},
+		{"let total = 0; for (x in [1, 2, 3]) { total += x; }; total", 6},
 	}
 
 	runVmTests(t, tests)
@@ -104,6 +327,7 @@ func TestStringExpressions(t *testing.T) {
 		{`"monkey"`, "monkey"},
 		{`"mon" + "key"`, "monkey"},
 		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{`"say \"hi\"\n" + "\u{1F412}"`, "say \"hi\"\n🐒"},
 	}
 
 	runVmTests(t, tests)
@@ -391,6 +615,32 @@ func TestFunctionsWithArgumentsAndBindings(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn(a, b = 10) { a + b }; f(1)", 11},
+		{"let f = fn(a, b = 10) { a + b }; f(1, 2)", 3},
+		{"let f = fn(a = 1, b = a * 2) { [a, b] }; f()", []int{1, 2}},
+		{"let f = fn(a = 1, b = a * 2) { [a, b] }; f(5)", []int{5, 10}},
+		{"let f = fn(a = 1, b = a * 2) { [a, b] }; f(5, 6)", []int{5, 6}},
+		{"let f = fn(a, b = if (false) { 1 }) { b }; f(1)", Null},
+		{"let f = fn(first, ...rest) { rest }; f(1, 2, 3)", []int{2, 3}},
+		{"let f = fn(first, ...rest) { rest }; f(1)", []int{}},
+		{"let f = fn(...args) { len(args) }; f() + f(1, 2, 3)", 3},
+		{"let f = fn(a, b = 2, ...rest) { a + b + len(rest) }; f(1)", 3},
+		{"let f = fn(a, b = 2, ...rest) { a + b + len(rest) }; f(1, 5, 9, 9)", 8},
+		{"let sum = fn(...xs) { let total = 0; for (x in xs) { total += x } total }; sum(1, 2, 3, 4)", 10},
+		{"let count = fn(n = 0) { fn() { n += 1 } }; let c = count(); c(); c()", 2},
+		{"let count = fn(n = 0) { fn() { n += 1 } }; let c = count(10); c(); c()", 12},
+		{"let f = fn(a, g = fn() { a }) { g() }; f(7)", 7},
+		{"let base = 100; let f = fn(a, b = base) { a + b }; f(1)", 101},
+		{"let fact = fn(n, acc = 1) { if (n == 0) { return acc; } fact(n - 1, acc * n) }; fact(5)", 120},
+		{"let apply = fn(f, ...args) { f(args) }; apply(fn(xs) { len(xs) }, 1, 2)", 2},
+		{"let wrap = fn(f) { fn(...args) { f(args[0], args[1]) } }; wrap(fn(a, b) { a - b })(5, 3)", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -405,6 +655,81 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 			input:    `fn(a, b) { a + b; }(1);`,
 			expected: "wrong number of arguments: want=2, got=1",
 		},
+		{
+			input:    `fn(a, b = 1) { a + b; }();`,
+			expected: "wrong number of arguments: want=1 to 2, got=0",
+		},
+		{
+			input:    `fn(a, b = 1) { a + b; }(1, 2, 3);`,
+			expected: "wrong number of arguments: want=1 to 2, got=3",
+		},
+		{
+			input:    `fn(a, ...rest) { a; }();`,
+			expected: "wrong number of arguments: want=at least 1, got=0",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.ByteCode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected vm error, but got nil")
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong error message. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestDestructuringLet(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [a, b] = [1]; b", Null},
+		{"let [a, ...rest] = [1, 2, 3]; rest", []int{2, 3}},
+		{"let [a, b, ...rest] = [1]; rest", []int{}},
+		{"let [_, b] = [1, 2]; b", 2},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", 6},
+		{"let [a, [b, c]] = [1]; c", Null},
+		{"let {\"x\": x, \"y\": y} = {\"x\": 1, \"y\": 2}; x - y", -1},
+		{"let {\"x\": x, \"z\": z} = {\"x\": 1}; z", Null},
+		{"let {\"p\": [x, y]} = {\"p\": [3, 4]}; x * y", 12},
+		{"let! [a, b] = [1, 2, 3]; a + b", 3},
+		{"let! {\"x\": x} = {\"x\": 5, \"y\": 6}; x", 5},
+		{"let a = 1; let b = 2; let [a, b] = [b, a]; a * 10 + b", 21},
+		{"let pair = fn() { [1, 2] }; let f = fn() { let [a, b] = pair(); a + b }; f()", 3},
+		{"let f = fn(point) { let {\"x\": x, \"y\": y} = point; fn() { x + y } }; f({\"x\": 1, \"y\": 2})()", 3},
+		{"let f = fn() { let [n] = [0]; let inc = fn() { n += 1 }; inc(); inc(); n }; f()", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0", "division by zero"},
+		{"5 % 0", "division by zero"},
+		{"let div = fn(a, b) { a / b }; div(10, 5) + div(1, 0);", "division by zero"},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"let a = [1]; a[1] = 2;", "index out of range: 1 with length 1"},
+		{"let a = 1; a[0] = 2;", "index assignment not supported: INTEGER"},
+		{"let [a] = 1;", "cannot destructure INTEGER as ARRAY"},
+		{"let {\"a\": a} = [1];", "cannot destructure ARRAY as HASH"},
+		{"let! [a, b] = [1];", "index out of range: 1 with length 1"},
+		{"let! [a, _] = [1];", "index out of range: 1 with length 1"},
+		{"let! {\"a\": a, \"b\": b} = {\"a\": 1};", "missing key b"},
+		{"let! [a, [b]] = [1];", "index out of range: 1 with length 1"},
+		{"let! [a, [b]] = [1, []];", "index out of range: 0 with length 0"},
+		{"let! [a, [b]] = [1, 2];", "cannot destructure INTEGER as ARRAY"},
+		{"let! [a] = if (false) { 1 };", "cannot destructure NULL as ARRAY"},
 	}
 
 	for _, tt := range tests {
@@ -425,6 +750,78 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 	}
 }
 
+func TestRuntimeErrorTrace(t *testing.T) {
+	input := `let add = fn(a, b) { a / b };
+let wrapper = fn() {
+  add(1, 0);
+};
+wrapper();`
+
+	program := parse(input)
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.ByteCode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected vm error, but got nil")
+	}
+
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%+v)", err, err)
+	}
+
+	expected := []struct {
+		function string
+		line     int
+		column   int
+	}{
+		{"<main>", 5, 8},
+		{"wrapper", 3, 6},
+		{"add", 1, 24},
+	}
+
+	if len(runtimeErr.Trace) != len(expected) {
+		t.Fatalf("wrong number of trace entries. want=%d, got=%d (%+v)", len(expected), len(runtimeErr.Trace), runtimeErr.Trace)
+	}
+
+	for i, want := range expected {
+		entry := runtimeErr.Trace[i]
+		if entry.Function != want.function || entry.Line != want.line || entry.Column != want.column {
+			t.Errorf("trace[%d] wrong. want=%s at %d:%d, got=%s", i, want.function, want.line, want.column, entry)
+		}
+	}
+
+	traceback := runtimeErr.Traceback()
+	if !strings.HasPrefix(traceback, "Traceback (most recent call last):\n  in <main> at 5:8") {
+		t.Errorf("traceback has wrong header. got=%q", traceback)
+	}
+	if !strings.HasSuffix(traceback, "\nRuntimeError: division by zero") {
+		t.Errorf("traceback has wrong message. got=%q", traceback)
+	}
+}
+
+func TestRunRecoversFromPanics(t *testing.T) {
+	// popping from an empty stack indexes the stack out of range
+	bytecode := &compiler.ByteCode{
+		Instructions: code.Make(code.OpPop),
+		Constants:    []object.Object{},
+	}
+
+	vm := New(bytecode)
+	err := vm.Run()
+	if err == nil {
+		t.Fatalf("expected vm error, but got nil")
+	}
+	if !strings.HasPrefix(err.Error(), "internal vm error: ") {
+		t.Fatalf("wrong error message. got=%q", err.Error())
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []vmTestCase{
 		{`len("")`, 0},
@@ -456,6 +853,377 @@ func TestBuiltinFunctions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`map([], fn(x) { x })`, []int{}},
+		{`let offset = 10; map([1, 2], fn(x) { x + offset })`, []int{11, 12}},
+		{`map([[1], [2, 3]], len)`, []int{1, 2}},
+		{`map(map([1, 2], fn(x) { [x] }), first)`, []int{1, 2}},
+		{`filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })`, []int{2, 4}},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, 10},
+		{`let sum = fn(arr) { reduce(arr, 0, fn(acc, x) { acc + x }) }; sum(map([1, 2], fn(x) { sum([x, x]) }))`, 6},
+		{`map(1, fn(x) { x })`, &object.Error{Message: "argument to `map` must be ARRAY, got INTEGER"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallbackErrorStopsProgram(t *testing.T) {
+	input := `let half = fn(x) { x / 0 };
+map([1, 2], half);
+puts("unreachable");`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.ByteCode())
+	err = vm.Run()
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%+v)", err, err)
+	}
+	if runtimeErr.Error() != "division by zero" {
+		t.Errorf("wrong error message. got=%q", runtimeErr.Error())
+	}
+
+	// the trace continues through the builtin into the callback
+	functions := []string{}
+	for _, entry := range runtimeErr.Trace {
+		functions = append(functions, entry.Function)
+	}
+	if strings.Join(functions, " > ") != "<main> > half" {
+		t.Errorf("wrong trace. got=%v", functions)
+	}
+}
+
+func TestCallbackErrorIgnoredByBuiltin(t *testing.T) {
+	builtins := object.NewRegistry()
+	builtins.Register("try", func(host object.Host, args ...object.Object) object.Object {
+		if _, err := host.Call(args[0]); err != nil {
+			return &object.String{Value: "caught"}
+		}
+		return nil
+	})
+
+	comp := compiler.NewWithBuiltins(builtins)
+	err := comp.Compile(parse(`try(fn() { 1 / 0 })`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	// a failed callback stops the program, even if the builtin carries on
+	vm := NewWithState(comp.ByteCode(), make([]object.Object, GlobalsSize), builtins)
+	err = vm.Run()
+	if err == nil || err.Error() != "division by zero" {
+		t.Errorf("expected division by zero, got=%v", err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	input := `let counter = 5; let add = fn(a, b) { a + b + counter }; let fail = fn() { 1 / 0 };`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.ByteCode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	result, err := vm.Call(vm.globals[1], &object.Integer{Value: 1}, &object.Integer{Value: 2})
+	if err != nil {
+		t.Fatalf("call error: %s", err)
+	}
+	testExpectedObject(t, 8, result)
+
+	_, err = vm.Call(vm.globals[2])
+	if err == nil || err.Error() != "division by zero" {
+		t.Fatalf("wrong call error. got=%v", err)
+	}
+	if _, ok := err.(*RuntimeError); !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T", err)
+	}
+
+	// the VM is left usable after a failed call
+	result, err = vm.Call(object.GetBuiltinByName("len"), &object.String{Value: "four"})
+	if err != nil {
+		t.Fatalf("call error: %s", err)
+	}
+	testExpectedObject(t, 4, result)
+	if vm.sp != 0 || vm.framesIndex != 1 {
+		t.Errorf("vm state not restored. sp=%d, framesIndex=%d", vm.sp, vm.framesIndex)
+	}
+}
+
+func TestInstructionLimit(t *testing.T) {
+	input := `let spin = fn(n) { if (n == 0) { 0 } else { spin(n - 1) } }; spin(100);`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.ByteCode())
+	vm.SetMaxInstructions(50)
+	err = vm.Run()
+	if !errors.Is(err, ErrInstructionLimit) {
+		t.Fatalf("expected ErrInstructionLimit, got=%v", err)
+	}
+	if _, ok := err.(*RuntimeError); !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T", err)
+	}
+
+	vm = New(comp.ByteCode())
+	vm.SetMaxInstructions(5000)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	registry := object.NewRegistry()
+	registry.Register("cancel", func(host object.Host, args ...object.Object) object.Object {
+		cancel()
+		return nil
+	})
+
+	input := `let spin = fn(n) { if (n == 0) { 0 } else { spin(n - 1) } }; cancel(); spin(500);`
+	comp := compiler.NewWithBuiltins(registry)
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := NewWithState(comp.ByteCode(), make([]object.Object, GlobalsSize), registry)
+	err = vm.RunContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got=%v", err)
+	}
+	if err.Error() != "execution canceled: context canceled" {
+		t.Errorf("wrong error message. got=%q", err.Error())
+	}
+	if errors.Is(err, ErrInstructionLimit) {
+		t.Errorf("cancellation must be distinguishable from the instruction limit")
+	}
+
+	// a context that is already done stops the run before it starts
+	err = New(comp.ByteCode()).RunContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got=%v", err)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		input string
+		limit int64
+	}{
+		// arrays grown by a builtin
+		{`let grow = fn(arr, n) { if (n == 0) { arr } else { grow(push(arr, n), n - 1) } }; grow([], 500);`, 100000},
+		// array literals
+		{`let grow = fn(n) { if (n == 0) { [] } else { [grow(n - 1), n] } }; grow(500);`, 10000},
+		// hash literals
+		{`let grow = fn(n) { if (n == 0) { {} } else { {n: grow(n - 1)} } }; grow(500);`, 10000},
+		// string concatenation
+		{`let grow = fn(s, n) { if (n == 0) { s } else { grow(s + s, n - 1) } }; grow("monkey", 30);`, 1 << 20},
+		// arrays built by a builtin calling back into a closure
+		{`map([1, 2, 3], fn(x) { push([], x) })`, 100},
+		// characters of a string made by a for-in loop
+		{`for (ch in "abcdefghijklmnopqrstuvwxyz") { ch }`, 100},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.ByteCode())
+		vm.SetMemoryLimit(tt.limit)
+		err = vm.Run()
+		if !errors.Is(err, ErrMemoryLimit) {
+			t.Errorf("%q: expected ErrMemoryLimit, got=%v", tt.input, err)
+			continue
+		}
+		if _, ok := err.(*RuntimeError); !ok {
+			t.Errorf("%q: error is not *RuntimeError. got=%T", tt.input, err)
+		}
+
+		// without a limit the program runs
+		vm = New(comp.ByteCode())
+		if tt.limit < 1<<20 {
+			if err := vm.Run(); err != nil {
+				t.Errorf("%q: vm error without limit: %s", tt.input, err)
+			}
+		}
+	}
+}
+
+func TestMemoryLimitExemptsConstants(t *testing.T) {
+	input := `let s = "` + strings.Repeat("monkey", 100) + `"; [s, s, s]; len(s)`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	// the array counts, the string constant doesn't
+	vm := New(comp.ByteCode())
+	vm.SetMemoryLimit(object.ArraySize(3))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 600, vm.LastPoppedStackElem())
+}
+
+func TestRecursionDepth(t *testing.T) {
+	tests := []struct {
+		input     string
+		stackSize int
+		maxFrames int
+		expected  error
+	}{
+		// the frame limit is hit first
+		{`let f = fn() { f() }; f();`, 0, 0, ErrRecursionDepth},
+		// the stack is used up first
+		{`let f = fn(n) { f(n + 1) }; f(0);`, 0, 0, ErrRecursionDepth},
+		{`let f = fn(a, b, c) { let d = a; f(a, b, c) }; f(1, 2, 3);`, 0, 0, ErrRecursionDepth},
+		{`let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(20);`, 0, 10, ErrRecursionDepth},
+		{`let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(5);`, 0, 10, nil},
+		{`let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(5000);`, 0, 0, ErrRecursionDepth},
+		{`let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(5000);`, 1 << 16, 1 << 14, nil},
+		{`[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12]`, 10, 0, ErrStackOverflow},
+		{`let f = fn() { [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12] }; f()`, 10, 0, ErrRecursionDepth},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.ByteCode())
+		if tt.stackSize != 0 {
+			vm.SetStackSize(tt.stackSize)
+		}
+		if tt.maxFrames != 0 {
+			vm.SetMaxFrames(tt.maxFrames)
+		}
+
+		err = vm.Run()
+		if tt.expected == nil {
+			if err != nil {
+				t.Errorf("%q: vm error: %s", tt.input, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%q: expected %q, got=%v", tt.input, tt.expected, err)
+			continue
+		}
+		if _, ok := err.(*RuntimeError); !ok {
+			t.Errorf("%q: error is not *RuntimeError. got=%T", tt.input, err)
+		}
+	}
+}
+
+func TestTracebackCollapsesRepeatedFrames(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let f = fn() { f() }; f();`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.ByteCode())
+	vm.SetMaxFrames(8)
+	err = vm.Run()
+
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("error is not *RuntimeError. got=%T (%+v)", err, err)
+	}
+
+	expected := `Traceback (most recent call last):
+  in <main> at 1:24 (offset 0011)
+  in f at 1:17 (offset 0002)
+  in f at 1:17 (offset 0002)
+  in f at 1:17 (offset 0002)
+  [previous entry repeated 4 more times]
+RuntimeError: maximum recursion depth exceeded`
+	if runtimeErr.Traceback() != expected {
+		t.Errorf("wrong traceback.\nwant=\n%s\ngot=\n%s", expected, runtimeErr.Traceback())
+	}
+}
+
+func TestBuiltinIO(t *testing.T) {
+	input := `let say = fn(x) { puts(x) }; say("hello"); map([1, 2], fn(x) { puts(x * 10) });`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out bytes.Buffer
+	vm := New(comp.ByteCode())
+	vm.SetIO(&object.IO{Stdout: &out})
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if out.String() != "hello\n10\n20\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func TestBuiltinRegistry(t *testing.T) {
+	newRegistry := func(answer int64) *object.Registry {
+		registry := object.NewRegistry()
+		registry.Register("answer", func(host object.Host, args ...object.Object) object.Object {
+			return &object.Integer{Value: answer}
+		})
+		return registry
+	}
+
+	for _, answer := range []int64{42, 7} {
+		registry := newRegistry(answer)
+
+		comp := compiler.NewWithBuiltins(registry)
+		err := comp.Compile(parse(`answer() + len([1])`))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := NewWithState(comp.ByteCode(), make([]object.Object, GlobalsSize), registry)
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, int(answer+1), vm.LastPoppedStackElem())
+	}
+
+	// the standard registry doesn't know about host builtins
+	err := compiler.New().Compile(parse(`answer()`))
+	if err == nil || err.Error() != "1:1: undefined variable answer" {
+		t.Errorf("expected answer to be undefined. got=%v", err)
+	}
+}
+
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -534,6 +1302,97 @@ func TestClosures(t *testing.T) {
 
 	runVmTests(t, tests)
 }
+
+func TestMutableClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let counter = fn() { let n = 0; fn() { n += 1 } };
+			let c = counter();
+			c(); c();
+			c();
+			`,
+			expected: 3,
+		},
+		{
+			// each call of counter gets its own variable
+			input: `
+			let counter = fn() { let n = 0; fn() { n += 1 } };
+			let a = counter();
+			let b = counter();
+			a(); a(); b();
+			a() * 10 + b();
+			`,
+			expected: 32,
+		},
+		{
+			// the defining function sees assignments made by its closures, and the other way around
+			input: `
+			let f = fn() {
+				let n = 1;
+				let inc = fn() { n = n + 1 };
+				let get = fn() { n };
+				inc();
+				n = n * 10;
+				inc();
+				get() * 100 + n;
+			};
+			f();
+			`,
+			expected: 2121,
+		},
+		{
+			input: `
+			let adder = fn(total) { fn(x) { total += x; total } };
+			let add = adder(10);
+			add(1);
+			add(2);
+			`,
+			expected: 13,
+		},
+		{
+			// captured through an intermediate function
+			input: `
+			let f = fn() {
+				let n = 0;
+				let g = fn() { fn() { n += 5 } };
+				g()();
+				g()();
+				n;
+			};
+			f();
+			`,
+			expected: 10,
+		},
+		{
+			input: `
+			let f = fn() {
+				let fns = [];
+				for (x in [1, 2, 3]) { fns = push(fns, fn() { x }) }
+				fns[0]() + fns[2]();
+			};
+			f();
+			`,
+			expected: 6,
+		},
+		{
+			// captures that never change are still copied
+			input: `
+			let f = fn(a) { let b = 2; fn() { a * b } };
+			f(21)();
+			`,
+			expected: 42,
+		},
+		// a function can assign to the variable holding it
+		{"let f = fn() { f = 1 }; f()", 1},
+		{"let f = fn() { f = 1 }; f(); f", 1},
+		{"let g = fn() { let f = fn() { f = 1 }; f(); f }; g()", 1},
+		{"let f = fn(n) { if (n == 0) { f = 10; 0 } else { f(n - 1) } }; f(3); f", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestRecursiveFunctions(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -661,6 +1520,11 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 		if err != nil {
 			t.Errorf("testBooleanObject failed: %s", err)
 		}
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Errorf("testFloatObject failed: %s", err)
+		}
 	case string:
 		err := testStringObject(expected, actual)
 		if err != nil {
@@ -738,6 +1602,19 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%f, want=%f", result.Value, expected)
+	}
+
+	return nil
+}
+
 func testBooleanObject(expected bool, actual object.Object) error {
 	result, ok := actual.(*object.Boolean)
 	if !ok {
@@ -0,0 +1,314 @@
+// Package monkey embeds the Monkey programming language in Go programs.
+//
+// A Runtime compiles and runs Monkey source on the bytecode VM. Globals survive
+// between runs, so host code can define values and functions, run scripts that
+// use them, and read back the results:
+//
+//	rt := monkey.New()
+//	rt.Register("double", func(args ...interface{}) (interface{}, error) {
+//		return args[0].(int64) * 2, nil
+//	})
+//	result, err := rt.Run(`double(21)`)
+//
+// Values cross the boundary as plain Go values: nil, bool, int64, float64, string,
+// []interface{}, map[interface{}]interface{} and *Function for Monkey functions.
+// Host code may also pass int, float32, int32 and map[string]interface{}.
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/natac13/monkey-compiler/internal/ast"
+	"github.com/natac13/monkey-compiler/internal/compiler"
+	"github.com/natac13/monkey-compiler/internal/lexer"
+	"github.com/natac13/monkey-compiler/internal/object"
+	"github.com/natac13/monkey-compiler/internal/parser"
+	"github.com/natac13/monkey-compiler/internal/vm"
+)
+
+// Runtime holds the compiler and VM state shared by every program it runs.
+// A Runtime is not safe for concurrent use.
+type Runtime struct {
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+	builtins    *object.Registry
+	io          *object.IO
+	// maxInstructions and memoryLimit limit each run, 0 for no limit
+	maxInstructions int64
+	memoryLimit     int64
+	// machine is the VM currently executing, so host functions can call back into it
+	machine *vm.VM
+}
+
+// HostFunc is a Go function callable from Monkey code.
+// A returned error is raised in the script as a Monkey error value.
+type HostFunc func(args ...interface{}) (interface{}, error)
+
+// ErrInstructionLimit is wrapped by the RuntimeError of a run that exceeded the limit
+// set with SetMaxInstructions.
+var ErrInstructionLimit = vm.ErrInstructionLimit
+
+// ErrMemoryLimit is wrapped by the RuntimeError of a run that exceeded the limit
+// set with SetMemoryLimit.
+var ErrMemoryLimit = vm.ErrMemoryLimit
+
+// SyntaxError is returned when the source can't be parsed.
+type SyntaxError struct {
+	Messages []string
+}
+
+func (e *SyntaxError) Error() string {
+	return "syntax error: " + strings.Join(e.Messages, "; ")
+}
+
+// CompileError is returned when parsed source can't be compiled, e.g. for an undefined variable.
+type CompileError struct {
+	Err error
+}
+
+func (e *CompileError) Error() string { return "compile error: " + e.Err.Error() }
+func (e *CompileError) Unwrap() error { return e.Err }
+
+// RuntimeError is returned when the VM stops with an error, or when a program or
+// called function evaluates to a Monkey error value.
+type RuntimeError struct {
+	Err error
+	// traceback is the formatted call stack at the time of the error, empty for error values
+	traceback string
+}
+
+func (e *RuntimeError) Error() string { return e.Err.Error() }
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// Traceback returns the Monkey call stack of the error in the same format the CLI prints.
+func (e *RuntimeError) Traceback() string {
+	if e.traceback == "" {
+		return "RuntimeError: " + e.Err.Error()
+	}
+	return e.traceback
+}
+
+// New returns a Runtime with the standard builtins defined.
+func New() *Runtime {
+	builtins := object.NewRegistry()
+	symbolTable := compiler.NewSymbolTable()
+	symbolTable.DefineBuiltins(builtins)
+
+	return &Runtime{
+		symbolTable: symbolTable,
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalsSize),
+		builtins:    builtins,
+		io:          object.StandardIO(),
+	}
+}
+
+// SetIO sets the streams scripts use, e.g. for the output of puts.
+// They default to the process's standard streams.
+func (r *Runtime) SetIO(stdin io.Reader, stdout, stderr io.Writer) {
+	r.io = &object.IO{Stdin: stdin, Stdout: stdout, Stderr: stderr}
+}
+
+// SetMaxInstructions limits the number of VM instructions each Run or Call may execute,
+// 0 for no limit. Exceeding it fails with a RuntimeError wrapping ErrInstructionLimit.
+func (r *Runtime) SetMaxInstructions(n int64) {
+	r.maxInstructions = n
+}
+
+// SetMemoryLimit limits the approximate number of bytes each Run or Call may allocate
+// for strings, arrays and hashes, 0 for no limit. Values returned by host functions count
+// towards it, the constants of the program don't. Exceeding it fails with a RuntimeError
+// wrapping ErrMemoryLimit.
+func (r *Runtime) SetMemoryLimit(n int64) {
+	r.memoryLimit = n
+}
+
+// Run compiles and runs source, returning the value of its last expression statement.
+// Globals defined by source stay available to later runs and to Get.
+func (r *Runtime) Run(source string) (interface{}, error) {
+	return r.RunContext(context.Background(), source)
+}
+
+// RunContext is like Run, but stops once ctx is done. The returned RuntimeError then
+// wraps ctx.Err(), e.g. errors.Is(err, context.DeadlineExceeded) reports a timeout.
+func (r *Runtime) RunContext(ctx context.Context, source string) (interface{}, error) {
+	l := lexer.New(source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &SyntaxError{Messages: p.Errors()}
+	}
+
+	// source is compiled against a copy of the globals, so the names a failed compilation
+	// defined don't stay behind without a value
+	symbolTable := r.symbolTable.Clone()
+	comp := compiler.NewWithState(symbolTable, r.constants)
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, &CompileError{Err: err}
+	}
+
+	bytecode := comp.ByteCode()
+	r.symbolTable = symbolTable
+	r.constants = bytecode.Constants
+
+	result, err := r.execute(ctx, bytecode)
+	if err != nil {
+		return nil, err
+	}
+
+	// the VM leaves the last popped value behind even for let statements
+	if n := len(program.Statements); n == 0 {
+		return nil, nil
+	} else if _, ok := program.Statements[n-1].(*ast.ExpressionStatement); !ok {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// Set assigns a Go value to the global name, defining it if needed.
+func (r *Runtime) Set(name string, value interface{}) error {
+	obj, err := toValue(value)
+	if err != nil {
+		return err
+	}
+	return r.setGlobal(name, obj)
+}
+
+// Get returns the value of the global name converted to Go.
+// It reports false if no such global has been defined.
+func (r *Runtime) Get(name string) (interface{}, bool) {
+	symbol, ok := r.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		return nil, false
+	}
+	return fromValue(r.globals[symbol.Index]), true
+}
+
+// Register defines a builtin function name that calls fn, replacing a standard builtin
+// of the same name. Builtins are private to the Runtime.
+// Arguments and the result are converted as described in the package documentation.
+func (r *Runtime) Register(name string, fn HostFunc) error {
+	if symbol, ok := r.symbolTable.Resolve(name); ok && symbol.Scope == compiler.GlobalScope {
+		return fmt.Errorf("cannot register %s, it is already a global", name)
+	}
+
+	index, err := r.builtins.Register(name, func(host object.Host, args ...object.Object) object.Object {
+		goArgs := make([]interface{}, len(args))
+		for i, arg := range args {
+			goArgs[i] = fromValue(arg)
+		}
+
+		result, err := fn(goArgs...)
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+
+		obj, err := toValue(result)
+		if err != nil {
+			return &object.Error{Message: fmt.Sprintf("%s: %s", name, err)}
+		}
+		if err := host.Allocate(sizeOf(obj)); err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		return obj
+	})
+	if err != nil {
+		return err
+	}
+
+	r.symbolTable.DefineBuiltin(index, name)
+	return nil
+}
+
+// Call calls a Monkey function with the given arguments and returns its result.
+// fn is usually a *Function read back with Get or passed to a HostFunc.
+// Called from a HostFunc, it runs re-entrantly on the VM executing the script.
+func (r *Runtime) Call(fn interface{}, args ...interface{}) (interface{}, error) {
+	callee, ok := fn.(*Function)
+	if !ok {
+		return nil, fmt.Errorf("cannot call %T", fn)
+	}
+
+	objArgs := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := toValue(arg)
+		if err != nil {
+			return nil, err
+		}
+		objArgs[i] = obj
+	}
+
+	machine := r.machine
+	if machine == nil {
+		machine = r.newMachine(&compiler.ByteCode{Constants: r.constants})
+	}
+
+	result, err := machine.Call(callee.obj, objArgs...)
+	if err != nil {
+		return nil, newRuntimeError(err)
+	}
+	return resultValue(result)
+}
+
+func (r *Runtime) execute(ctx context.Context, bytecode *compiler.ByteCode) (interface{}, error) {
+	machine := r.newMachine(bytecode)
+
+	outer := r.machine
+	r.machine = machine
+	defer func() { r.machine = outer }()
+
+	err := machine.RunContext(ctx)
+	if err != nil {
+		return nil, newRuntimeError(err)
+	}
+
+	return resultValue(machine.LastPoppedStackElem())
+}
+
+// newMachine returns a VM for bytecode sharing the Runtime's state and settings.
+func (r *Runtime) newMachine(bytecode *compiler.ByteCode) *vm.VM {
+	machine := vm.NewWithState(bytecode, r.globals, r.builtins)
+	machine.SetIO(r.io)
+	machine.SetMaxInstructions(r.maxInstructions)
+	machine.SetMemoryLimit(r.memoryLimit)
+	return machine
+}
+
+// resultValue converts the result of a run or call, turning Monkey error values into a *RuntimeError.
+func resultValue(result object.Object) (interface{}, error) {
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Err: errors.New(errObj.Message)}
+	}
+	return fromValue(result), nil
+}
+
+func newRuntimeError(err error) *RuntimeError {
+	runtimeErr := &RuntimeError{Err: err}
+
+	var vmErr *vm.RuntimeError
+	if errors.As(err, &vmErr) {
+		runtimeErr.Err = vmErr.Err
+		runtimeErr.traceback = vmErr.Traceback()
+	}
+	return runtimeErr
+}
+
+func (r *Runtime) setGlobal(name string, value object.Object) error {
+	symbol, ok := r.symbolTable.Resolve(name)
+	if ok && symbol.Scope != compiler.GlobalScope {
+		return fmt.Errorf("cannot redefine builtin %s", name)
+	}
+	if !ok {
+		symbol = r.symbolTable.Define(name)
+	}
+
+	r.globals[symbol.Index] = value
+	return nil
+}
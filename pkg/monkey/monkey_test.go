@@ -0,0 +1,315 @@
+package monkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2", int64(3)},
+		{"1.5 * 2", 3.0},
+		{`"mon" + "key"`, "monkey"},
+		{"1 < 2", true},
+		{"if (false) { 1 }", nil},
+		{"[1, [2, 3]]", []interface{}{int64(1), []interface{}{int64(2), int64(3)}}},
+		{`{"a": 1, 2: true}`, map[interface{}]interface{}{"a": int64(1), int64(2): true}},
+		{"let x = 1;", nil},
+	}
+
+	for _, tt := range tests {
+		result, err := New().Run(tt.input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", tt.input, err)
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("%q: wrong result. want=%#v, got=%#v", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	rt := New()
+
+	_, err := rt.Run("let = 1;")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("expected *SyntaxError, got=%T (%v)", err, err)
+	}
+
+	_, err = rt.Run("missing")
+	var compileErr *CompileError
+	if !errors.As(err, &compileErr) {
+		t.Errorf("expected *CompileError, got=%T (%v)", err, err)
+	}
+
+	// the names defined before the compile error are dropped with it
+	_, err = rt.Run("let defined = 1; missing")
+	if !errors.As(err, &compileErr) {
+		t.Errorf("expected *CompileError, got=%T (%v)", err, err)
+	}
+	if _, ok := rt.Get("defined"); ok {
+		t.Errorf("expected defined not to be found after the failed run")
+	}
+	_, err = rt.Run("defined")
+	if !errors.As(err, &compileErr) {
+		t.Errorf("expected *CompileError, got=%T (%v)", err, err)
+	}
+
+	_, err = rt.Run("let f = fn() { 1 / 0 }; f();")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError, got=%T (%v)", err, err)
+	}
+	if runtimeErr.Error() != "division by zero" {
+		t.Errorf("wrong error message. got=%q", runtimeErr.Error())
+	}
+	if !strings.Contains(runtimeErr.Traceback(), "in f at 1:18") {
+		t.Errorf("traceback is missing the function frame:\n%s", runtimeErr.Traceback())
+	}
+
+	_, err = rt.Run(`len(1)`)
+	if !errors.As(err, &runtimeErr) || err.Error() != "argument to `len` not supported, got INTEGER" {
+		t.Errorf("expected error value to be returned as *RuntimeError, got=%T (%v)", err, err)
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	rt := New()
+
+	err := rt.Set("config", map[string]interface{}{"limit": 10, "name": "monkey"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err = rt.Run(`let total = config["limit"] * 2; let name = config["name"];`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if total, ok := rt.Get("total"); !ok || total != int64(20) {
+		t.Errorf("wrong total. got=%#v (%t)", total, ok)
+	}
+	if name, ok := rt.Get("name"); !ok || name != "monkey" {
+		t.Errorf("wrong name. got=%#v (%t)", name, ok)
+	}
+	if _, ok := rt.Get("undefined"); ok {
+		t.Errorf("expected undefined global not to be found")
+	}
+
+	if err := rt.Set("len", 1); err == nil {
+		t.Errorf("expected an error when overwriting a builtin")
+	}
+	if err := rt.Set("bad", struct{}{}); err == nil {
+		t.Errorf("expected an error for an unconvertible value")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	rt := New()
+
+	err := rt.Register("sum", func(args ...interface{}) (interface{}, error) {
+		var total int64
+		for _, arg := range args {
+			n, ok := arg.(int64)
+			if !ok {
+				return nil, errors.New("sum: arguments must be integers")
+			}
+			total += n
+		}
+		return total, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := rt.Run(`let apply = fn(f) { f(1, 2, 3) }; apply(sum)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result != int64(6) {
+		t.Errorf("wrong result. got=%#v", result)
+	}
+
+	_, err = rt.Run(`sum(1, "two")`)
+	if err == nil || err.Error() != "sum: arguments must be integers" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	rt := New()
+
+	_, err := rt.Run(`
+	let greeting = "hello ";
+	let makeGreeter = fn(suffix) { fn(name) { greeting + name + suffix } };
+	let greet = makeGreeter("!");
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	greet, _ := rt.Get("greet")
+	result, err := rt.Call(greet, "monkey")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result != "hello monkey!" {
+		t.Errorf("wrong result. got=%#v", result)
+	}
+
+	length, _ := rt.Get("len")
+	if length != nil {
+		t.Errorf("builtins are not globals, got=%#v", length)
+	}
+
+	_, err = rt.Call(greet)
+	if err == nil || err.Error() != "wrong number of arguments: want=1, got=0" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+
+	_, err = rt.Call("greet")
+	if err == nil {
+		t.Errorf("expected an error when calling a non-function")
+	}
+}
+
+func TestHostFunctionCallback(t *testing.T) {
+	rt := New()
+
+	var events []interface{}
+	rt.Register("on", func(args ...interface{}) (interface{}, error) {
+		for _, event := range []string{"start", "stop"} {
+			result, err := rt.Call(args[0], event)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, result)
+		}
+		return nil, nil
+	})
+
+	_, err := rt.Run(`let prefix = "got "; on(fn(event) { prefix + event });`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []interface{}{"got start", "got stop"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("wrong events. want=%#v, got=%#v", expected, events)
+	}
+
+	_, err = rt.Run(`on(fn(event) { 1 / 0 }); puts("unreachable")`)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Error() != "division by zero" {
+		t.Errorf("expected callback error to stop the script, got=%v", err)
+	}
+}
+
+func TestRegisterIsPerRuntime(t *testing.T) {
+	first, second := New(), New()
+
+	var output []interface{}
+	first.Register("puts", func(args ...interface{}) (interface{}, error) {
+		output = append(output, args...)
+		return nil, nil
+	})
+	first.Register("name", func(args ...interface{}) (interface{}, error) { return "first", nil })
+	second.Register("name", func(args ...interface{}) (interface{}, error) { return "second", nil })
+
+	if _, err := first.Run(`puts(name(), len("four"))`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(output, []interface{}{"first", int64(4)}) {
+		t.Errorf("puts was not replaced. got=%#v", output)
+	}
+
+	result, err := second.Run(`name()`)
+	if err != nil || result != "second" {
+		t.Errorf("wrong result. got=%#v (%v)", result, err)
+	}
+
+	if _, err := New().Run(`name()`); err == nil {
+		t.Errorf("expected host function to be undefined in a new runtime")
+	}
+
+	second.Set("taken", 1)
+	if err := second.Register("taken", nil); err == nil {
+		t.Errorf("expected an error registering over a global")
+	}
+}
+
+func TestSetIO(t *testing.T) {
+	rt := New()
+
+	var stdout bytes.Buffer
+	rt.SetIO(strings.NewReader(""), &stdout, &stdout)
+
+	_, err := rt.Run(`let greet = fn(name) { puts("hello " + name) }; greet("monkey");`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	greet, _ := rt.Get("greet")
+	if _, err := rt.Call(greet, "gopher"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if stdout.String() != "hello monkey\nhello gopher\n" {
+		t.Errorf("wrong output. got=%q", stdout.String())
+	}
+}
+
+func TestLimits(t *testing.T) {
+	rt := New()
+	rt.SetMaxInstructions(1000)
+
+	_, err := rt.Run(`let spin = fn(n) { if (n == 0) { 0 } else { spin(n - 1) } }; spin(10)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err = rt.Run(`spin(500)`)
+	if !errors.Is(err, ErrInstructionLimit) {
+		t.Errorf("expected ErrInstructionLimit, got=%v", err)
+	}
+
+	spin, _ := rt.Get("spin")
+	_, err = rt.Call(spin, 500)
+	if !errors.Is(err, ErrInstructionLimit) {
+		t.Errorf("expected ErrInstructionLimit from Call, got=%v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	_, err = rt.RunContext(ctx, `spin(1)`)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got=%v", err)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	rt := New()
+	rt.SetMemoryLimit(4096)
+	rt.Register("big", func(args ...interface{}) (interface{}, error) {
+		return make([]interface{}, 1000), nil
+	})
+
+	if _, err := rt.Run(`let small = [1, 2, 3];`); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err := rt.Run(`big(); puts("unreachable")`)
+	if !errors.Is(err, ErrMemoryLimit) {
+		t.Errorf("expected ErrMemoryLimit, got=%v", err)
+	}
+}
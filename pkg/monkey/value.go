@@ -0,0 +1,146 @@
+package monkey
+
+import (
+	"fmt"
+
+	"github.com/natac13/monkey-compiler/internal/object"
+	"github.com/natac13/monkey-compiler/internal/vm"
+)
+
+// Function is a Monkey function value: a closure defined in a script, a builtin
+// or a registered HostFunc. Call it with Runtime.Call.
+type Function struct {
+	obj object.Object
+}
+
+// toValue converts a Go value to a Monkey object:
+//
+//	nil                                         -> null
+//	bool                                        -> boolean
+//	int, int32, int64                           -> integer
+//	float32, float64                            -> float
+//	string                                      -> string
+//	[]interface{}                               -> array
+//	map[string]interface{}, map[interface{}]... -> hash
+//	*Function                                   -> the wrapped function
+func toValue(value interface{}) (object.Object, error) {
+	switch value := value.(type) {
+	case nil:
+		return vm.Null, nil
+	case bool:
+		if value {
+			return vm.True, nil
+		}
+		return vm.False, nil
+	case int:
+		return &object.Integer{Value: int64(value)}, nil
+	case int32:
+		return &object.Integer{Value: int64(value)}, nil
+	case int64:
+		return &object.Integer{Value: value}, nil
+	case float32:
+		return &object.Float{Value: float64(value)}, nil
+	case float64:
+		return &object.Float{Value: value}, nil
+	case string:
+		return &object.String{Value: value}, nil
+	case *Function:
+		return value.obj, nil
+
+	case []interface{}:
+		elements := make([]object.Object, len(value))
+		for i, el := range value {
+			obj, err := toValue(el)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = obj
+		}
+		return &object.Array{Elements: elements}, nil
+
+	case map[string]interface{}:
+		generic := make(map[interface{}]interface{}, len(value))
+		for k, v := range value {
+			generic[k] = v
+		}
+		return toValue(generic)
+
+	case map[interface{}]interface{}:
+		pairs := make(map[object.HashKey]object.HashPair, len(value))
+		for k, v := range value {
+			key, err := toValue(k)
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %T", k)
+			}
+			val, err := toValue(v)
+			if err != nil {
+				return nil, err
+			}
+			pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: val}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	}
+
+	return nil, fmt.Errorf("cannot convert %T to a Monkey value", value)
+}
+
+// fromValue converts a Monkey object to Go, the inverse of toValue.
+// Integers become int64, arrays []interface{} and hashes map[interface{}]interface{}.
+// Functions become *Function and error values become error.
+func fromValue(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil
+	case *object.Boolean:
+		return obj.Value
+	case *object.Integer:
+		return obj.Value
+	case *object.Float:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Error:
+		return fmt.Errorf("%s", obj.Message)
+	case *object.Closure, *object.Builtin:
+		return &Function{obj: obj}
+
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			elements[i] = fromValue(el)
+		}
+		return elements
+
+	case *object.Hash:
+		pairs := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			pairs[fromValue(pair.Key)] = fromValue(pair.Value)
+		}
+		return pairs
+	}
+
+	return obj.Inspect()
+}
+
+// sizeOf returns the approximate size of obj including the elements, keys and values
+// it holds, all of which are newly allocated when converting a host function's result.
+func sizeOf(obj object.Object) int64 {
+	size := object.SizeOf(obj)
+
+	switch obj := obj.(type) {
+	case *object.Array:
+		for _, el := range obj.Elements {
+			size += sizeOf(el)
+		}
+	case *object.Hash:
+		for _, pair := range obj.Pairs {
+			size += sizeOf(pair.Key) + sizeOf(pair.Value)
+		}
+	}
+
+	return size
+}